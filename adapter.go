@@ -0,0 +1,95 @@
+package magic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WrapHandler function
+// Use standard http.Handler as handler
+// Request body is restored from context.Body
+func WrapHandler(handler http.Handler) HandlerFunc {
+	return func(context *Context) error {
+		context.Request.Body = ioutil.NopCloser(strings.NewReader(context.Body))
+		handler.ServeHTTP(context.Writer, context.Request)
+		return nil
+	}
+}
+
+// WrapMiddleware function
+// Use standard func(http.Handler) http.Handler as Middleware
+// Writer and Request passed by middleware to next handler are set to context
+func WrapMiddleware(middleware func(http.Handler) http.Handler) Middleware {
+	return NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) error {
+			var err error
+			writer, request := context.Writer, context.Request
+			defer func() {
+				context.Writer, context.Request = writer, request
+			}()
+			handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				context.Writer = w
+				context.Request = r
+				err = next(context)
+			}))
+			handler.ServeHTTP(context.Writer, context.Request)
+			return err
+		}
+	})
+}
+
+// Handle function
+// Add http.Handler to route
+// Method must be GET, POST, PUT or DELETE
+func (route *Route) Handle(method, path string, handler http.Handler, middlewares ...Middleware) *RouteHandle {
+	switch method {
+	case "GET", "POST", "PUT", "DELETE":
+		return route.add(path, method, WrapHandler(handler), middlewares...)
+	default:
+		panic(errMethod)
+	}
+}
+
+// MOUNT function
+// Add http.Handler for all paths which start with path
+// Path is stripped like "/debug/pprof/heap" -> "/pprof/heap" for MOUNT("/debug", ...)
+// MOUNT("/", ...) passes full path to handler
+// Full path must't contain params like "/a/:id/mount"
+func (route *Route) MOUNT(path string, handler http.Handler, middlewares ...Middleware) *RouteHandle {
+	prefix := strings.TrimSuffix(route.fullPath+path, "/")
+	if strings.Contains(prefix, ":") {
+		panic(errStaticRouteParams.Error() + ": " + prefix)
+	}
+	wrapped := WrapHandler(handler)
+	return route.add(path, "MOUNT", func(context *Context) error {
+		request := context.Request
+		stripped := *request
+		stripped.URL = new(url.URL)
+		*stripped.URL = *request.URL
+		stripped.URL.Path = strings.TrimPrefix(request.URL.Path, prefix)
+		stripped.URL.RawPath = ""
+		if stripped.URL.Path == "" {
+			stripped.URL.Path = "/"
+		}
+		context.Request = &stripped
+		defer func() {
+			context.Request = request
+		}()
+		return wrapped(context)
+	}, middlewares...)
+}
+
+// Handle function
+// Add http.Handler to route
+// Method must be GET, POST, PUT or DELETE
+func (magic *Magic) Handle(method, path string, handler http.Handler, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.Handle(method, path, handler, middlewares...)
+}
+
+// MOUNT function
+// Add http.Handler for all paths which start with path, path is stripped
+func (magic *Magic) MOUNT(path string, handler http.Handler, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.MOUNT(path, handler, middlewares...)
+}
@@ -0,0 +1,124 @@
+package magic
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoPathHandler function
+// Return http.Handler which writes path of request
+func echoPathHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})
+}
+
+func serveAdapter(router *Router, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func TestHandleAndWrapHandler(t *testing.T) {
+	router := NewRouter()
+	router.mainRoute.Handle("POST", "/echo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	recorder := serveAdapter(router, "POST", "/echo", `{"name":"magic"}`)
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != `{"name":"magic"}` {
+		t.Fatalf("body is not restored for handler: %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	defer func() {
+		if recover() != errMethod {
+			t.Fatal("expected panic on unsupported method")
+		}
+	}()
+	router.mainRoute.Handle("PATCH", "/echo", echoPathHandler())
+}
+
+func TestWrapMiddleware(t *testing.T) {
+	var original http.ResponseWriter
+	var restored bool
+	router := NewRouter()
+	router.Use(NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) error {
+			original = context.Writer
+			request := context.Request
+			defer func() {
+				recover()
+				restored = context.Writer == original && context.Request == request
+			}()
+			return next(context)
+		}
+	}))
+	router.Use(WrapMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Wrapped", "yes")
+			r = r.Clone(r.Context())
+			r.Header.Set("X-User", "bob")
+			next.ServeHTTP(&headerWriter{ResponseWriter: w}, r)
+		})
+	}))
+	router.mainRoute.GET("/", func(context *Context) error {
+		if _, ok := context.Writer.(*headerWriter); !ok {
+			t.Error("writer of middleware is not set to context")
+		}
+		return context.SendString(context.Request.Header.Get("X-User"))
+	})
+	router.mainRoute.GET("/panic", func(context *Context) error {
+		panic("handler failed")
+	})
+
+	recorder := serveAdapter(router, "GET", "/", "")
+	if recorder.Body.String() != "bob" || recorder.Header().Get("X-Wrapped") != "yes" {
+		t.Fatalf("request of middleware is not set to context: %q %v", recorder.Body.String(), recorder.Header())
+	}
+	if !restored {
+		t.Fatal("writer and request are not restored")
+	}
+	restored = false
+	serveAdapter(router, "GET", "/panic", "")
+	if !restored {
+		t.Fatal("writer and request are not restored after panic")
+	}
+}
+
+type headerWriter struct {
+	http.ResponseWriter
+}
+
+func TestMOUNT(t *testing.T) {
+	cases := []struct {
+		name  string
+		mount func(router *Router)
+		path  string
+		want  string
+	}{
+		{"prefix", func(router *Router) { router.mainRoute.MOUNT("/debug", echoPathHandler()) }, "/debug/pprof/heap", "/pprof/heap"},
+		{"prefix itself", func(router *Router) { router.mainRoute.MOUNT("/debug", echoPathHandler()) }, "/debug", "/"},
+		{"child route", func(router *Router) { router.mainRoute.CreateRoute("/api").MOUNT("/files", echoPathHandler()) }, "/api/files/a.txt", "/a.txt"},
+		{"root", func(router *Router) { router.mainRoute.MOUNT("/", echoPathHandler()) }, "/foo/bar", "/foo/bar"},
+	}
+	for _, test := range cases {
+		router := NewRouter()
+		test.mount(router)
+		for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+			if body := serveAdapter(router, method, test.path, "").Body.String(); body != test.want {
+				t.Fatalf("%s: %s %s: expected %q, got %q", test.name, method, test.path, test.want, body)
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on MOUNT with params")
+		}
+	}()
+	NewRouter().mainRoute.CreateRoute("/users/:id").MOUNT("/files", echoPathHandler())
+}
@@ -0,0 +1,163 @@
+package magic
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// PrincipalKey - key of authenticated principal in context.Storage
+const PrincipalKey = "principal"
+
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errAPIKey       = errors.New("miss or invalid API key")
+	errValidator    = errors.New("authentication middleware needs validator")
+)
+
+// BasicAuthValidator type
+// Return true if user and password are valid
+type BasicAuthValidator func(user, password string, context *Context) (bool, error)
+
+// BasicAuthUsers function
+// Return BasicAuthValidator for map user -> password
+// Passwords are compared in constant time
+func BasicAuthUsers(users map[string]string) BasicAuthValidator {
+	hashes := make(map[string][32]byte)
+	for user, password := range users {
+		hashes[user] = sha256.Sum256([]byte(password))
+	}
+	dummy := sha256.Sum256([]byte("magic"))
+	return func(user, password string, context *Context) (bool, error) {
+		expected, ok := hashes[user]
+		if !ok {
+			expected = dummy
+		}
+		actual := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(expected[:], actual[:]) == 1 && ok, nil
+	}
+}
+
+// NewBasicAuthMiddleware function
+// Create new HTTP Basic authentication middleware
+// User is stored in context.Storage[PrincipalKey], read it by context.Principal()
+// Send 401 with WWW-Authenticate challenge if user or password is invalid
+// Panic if validator is nil
+func NewBasicAuthMiddleware(validator BasicAuthValidator, realm string) Middleware {
+	if validator == nil {
+		panic(errValidator)
+	}
+	if realm == "" {
+		realm = "Restricted"
+	}
+	challenge := `Basic realm="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(realm) + `", charset="UTF-8"`
+	return NewMiddleware(func(context *Context) error {
+		user, password, ok := context.Request.BasicAuth()
+		if ok {
+			valid, err := validator(user, password, context)
+			if err == nil && valid {
+				context.Storage[PrincipalKey] = user
+				return nil
+			}
+		}
+		context.Writer.Header().Set("WWW-Authenticate", challenge)
+		context.Writer.WriteHeader(http.StatusUnauthorized)
+		return context.SendError(errUnauthorized)
+	})
+}
+
+// APIKeyValidator interface
+// Return principal of key or error if key is invalid
+type APIKeyValidator interface {
+	ValidateAPIKey(key string, context *Context) (interface{}, error)
+}
+
+// APIKeyValidatorFunc type
+// Function which implements APIKeyValidator
+type APIKeyValidatorFunc func(key string, context *Context) (interface{}, error)
+
+// ValidateAPIKey function
+// Call function
+func (fn APIKeyValidatorFunc) ValidateAPIKey(key string, context *Context) (interface{}, error) {
+	return fn(key, context)
+}
+
+type apiKeys struct {
+	hashes     [][32]byte
+	principals []interface{}
+}
+
+// APIKeys function
+// Return APIKeyValidator for map key -> principal
+// Keys are compared in constant time
+func APIKeys(keys map[string]interface{}) APIKeyValidator {
+	validator := &apiKeys{}
+	for key, principal := range keys {
+		validator.hashes = append(validator.hashes, sha256.Sum256([]byte(key)))
+		validator.principals = append(validator.principals, principal)
+	}
+	return validator
+}
+
+func (validator *apiKeys) ValidateAPIKey(key string, context *Context) (interface{}, error) {
+	hash := sha256.Sum256([]byte(key))
+	found := -1
+	for i, expected := range validator.hashes {
+		if subtle.ConstantTimeCompare(expected[:], hash[:]) == 1 {
+			found = i
+		}
+	}
+	if found < 0 {
+		return nil, errAPIKey
+	}
+	return validator.principals[found], nil
+}
+
+// APIKeyConfig structure
+// Header - header with key (default "X-API-Key")
+// Query - query param with key, not used if empty
+// Validator - validator of keys like APIKeys(map[string]interface{}{"key": "partner"})
+type APIKeyConfig struct {
+	Header    string
+	Query     string
+	Validator APIKeyValidator
+}
+
+// NewAPIKeyMiddleware function
+// Create new API key authentication middleware
+// Principal is stored in context.Storage[PrincipalKey], read it by context.Principal()
+// Send 401 with WWW-Authenticate like `APIKey header="X-API-Key"` if key is missed or invalid
+// Panic if there is no Validator
+func NewAPIKeyMiddleware(config APIKeyConfig) Middleware {
+	if config.Validator == nil {
+		panic(errValidator)
+	}
+	if config.Header == "" {
+		config.Header = "X-API-Key"
+	}
+	challenge := `APIKey header="` + config.Header + `"`
+	return NewMiddleware(func(context *Context) error {
+		key := context.Request.Header.Get(config.Header)
+		if key == "" && config.Query != "" {
+			key = context.Request.URL.Query().Get(config.Query)
+		}
+		if key != "" {
+			principal, err := config.Validator.ValidateAPIKey(key, context)
+			if err == nil && principal != nil {
+				context.Storage[PrincipalKey] = principal
+				return nil
+			}
+		}
+		context.Writer.Header().Set("WWW-Authenticate", challenge)
+		context.Writer.WriteHeader(http.StatusUnauthorized)
+		return context.SendError(errAPIKey)
+	})
+}
+
+// Principal function
+// Return principal of basic auth or API key middleware, nil if there is no
+func (context *Context) Principal() interface{} {
+	return context.Storage[PrincipalKey]
+}
@@ -0,0 +1,113 @@
+package magic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	router := NewRouter()
+	router.mainRoute.GET("/", func(context *Context) error {
+		return context.SendString(context.Principal().(string))
+	}, NewAPIKeyMiddleware(APIKeyConfig{
+		Query:     "api_key",
+		Validator: APIKeys(map[string]interface{}{"secret": "partner"}),
+	}))
+	cases := []struct {
+		name   string
+		header string
+		query  string
+		code   int
+	}{
+		{"key in header", "secret", "", http.StatusOK},
+		{"key in query", "", "?api_key=secret", http.StatusOK},
+		{"invalid key", "other", "", http.StatusUnauthorized},
+		{"missed key", "", "", http.StatusUnauthorized},
+	}
+	for _, test := range cases {
+		request := httptest.NewRequest("GET", "/"+test.query, nil)
+		if test.header != "" {
+			request.Header.Set("X-API-Key", test.header)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.name, test.code, recorder.Code)
+		}
+		if test.code == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") != `APIKey header="X-API-Key"` {
+			t.Fatalf("%s: wrong challenge %q", test.name, recorder.Header().Get("WWW-Authenticate"))
+		}
+		if test.code == http.StatusOK && recorder.Body.String() != "partner" {
+			t.Fatalf("%s: expected principal, got %s", test.name, recorder.Body.String())
+		}
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	router := NewRouter()
+	router.mainRoute.GET("/", func(context *Context) error {
+		return context.SendString(context.Principal().(string))
+	}, NewBasicAuthMiddleware(BasicAuthUsers(map[string]string{"bob": "password"}), `Admin "area"`))
+	router.mainRoute.GET("/default", func(context *Context) error {
+		return nil
+	}, NewBasicAuthMiddleware(func(user, password string, context *Context) (bool, error) {
+		return false, errUnauthorized
+	}, ""))
+
+	cases := []struct {
+		name     string
+		user     string
+		password string
+		code     int
+	}{
+		{"valid", "bob", "password", http.StatusOK},
+		{"wrong password", "bob", "other", http.StatusUnauthorized},
+		{"unknown user", "alice", "password", http.StatusUnauthorized},
+		{"empty password", "bob", "", http.StatusUnauthorized},
+		{"missed credentials", "", "", http.StatusUnauthorized},
+	}
+	for _, test := range cases {
+		request := httptest.NewRequest("GET", "/", nil)
+		if test.user != "" {
+			request.SetBasicAuth(test.user, test.password)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.name, test.code, recorder.Code)
+		}
+		if test.code == http.StatusOK && recorder.Body.String() != "bob" {
+			t.Fatalf("%s: expected principal, got %s", test.name, recorder.Body.String())
+		}
+		challenge := recorder.Header().Get("WWW-Authenticate")
+		if test.code == http.StatusUnauthorized && challenge != `Basic realm="Admin \"area\"", charset="UTF-8"` {
+			t.Fatalf("%s: wrong challenge %q", test.name, challenge)
+		}
+	}
+
+	request := httptest.NewRequest("GET", "/default", nil)
+	request.SetBasicAuth("bob", "password")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized || recorder.Header().Get("WWW-Authenticate") != `Basic realm="Restricted", charset="UTF-8"` {
+		t.Fatalf("validator error is not 401 with default realm: %d %q", recorder.Code, recorder.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestAuthMiddlewareWithoutValidatorPanics(t *testing.T) {
+	constructors := map[string]func(){
+		"api key":    func() { NewAPIKeyMiddleware(APIKeyConfig{}) },
+		"basic auth": func() { NewBasicAuthMiddleware(nil, "") },
+	}
+	for name, constructor := range constructors {
+		func() {
+			defer func() {
+				if recover() != errValidator {
+					t.Fatalf("%s: expected panic without validator", name)
+				}
+			}()
+			constructor()
+		}()
+	}
+}
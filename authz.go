@@ -0,0 +1,139 @@
+package magic
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var errForbidden = errors.New("forbidden")
+
+// Policy interface
+// Return true if authenticated user is allowed to do request
+type Policy interface {
+	Authorize(context *Context) bool
+}
+
+// PolicyFunc type
+// Function which implements Policy
+type PolicyFunc func(context *Context) bool
+
+// Authorize function
+// Call function
+func (fn PolicyFunc) Authorize(context *Context) bool {
+	return fn(context)
+}
+
+// RequirePolicy function
+// Create new middleware which checks policy after authentication middleware
+// Name is shown in permissions of magic.Routes()
+// Send 401 with WWW-Authenticate if there are no claims or principal, 403 if policy returns false
+func RequirePolicy(name string, policy Policy) Middleware {
+	middleware := NewMiddleware(func(context *Context) error {
+		return authorize(context, policy.Authorize(context))
+	})
+	middleware.permissions = []string{"policy:" + name}
+	return middleware
+}
+
+// RequireRoles function
+// Create new middleware which checks that user has all roles
+// Roles are read by context.Roles()
+// Send 401 if there are no claims or principal, 403 if role is missed
+func RequireRoles(roles ...string) Middleware {
+	middleware := NewMiddleware(func(context *Context) error {
+		return authorize(context, containsAll(context.Roles(), roles))
+	})
+	for _, role := range roles {
+		middleware.permissions = append(middleware.permissions, "role:"+role)
+	}
+	return middleware
+}
+
+// RequireScopes function
+// Create new middleware which checks that token has all scopes
+// Scopes are read by context.Scopes()
+// Send 401 if there are no claims or principal, 403 if scope is missed
+func RequireScopes(scopes ...string) Middleware {
+	middleware := NewMiddleware(func(context *Context) error {
+		return authorize(context, containsAll(context.Scopes(), scopes))
+	})
+	for _, scope := range scopes {
+		middleware.permissions = append(middleware.permissions, "scope:"+scope)
+	}
+	return middleware
+}
+
+// Roles function
+// Return roles from JWT claim "roles" (array or string)
+// or from principal of basic auth or API key middleware with method Roles() []string
+func (context *Context) Roles() []string {
+	if principal, ok := context.Principal().(interface{ Roles() []string }); ok {
+		return principal.Roles()
+	}
+	claims, _ := context.Storage[ClaimsKey].(map[string]interface{})
+	return claimStrings(claims["roles"], false)
+}
+
+// Scopes function
+// Return scopes from JWT claim "scope" (space separated string) or "scp" (array)
+// or from principal of basic auth or API key middleware with method Scopes() []string
+func (context *Context) Scopes() []string {
+	if principal, ok := context.Principal().(interface{ Scopes() []string }); ok {
+		return principal.Scopes()
+	}
+	claims, _ := context.Storage[ClaimsKey].(map[string]interface{})
+	if scope, ok := claims["scope"]; ok {
+		return claimStrings(scope, true)
+	}
+	return claimStrings(claims["scp"], true)
+}
+
+func authorize(context *Context, allowed bool) error {
+	if context.Storage[ClaimsKey] == nil && context.Storage[PrincipalKey] == nil {
+		context.Writer.Header().Set("WWW-Authenticate", "Bearer")
+		context.Writer.WriteHeader(http.StatusUnauthorized)
+		return context.SendError(errUnauthorized)
+	}
+	if !allowed {
+		context.Writer.WriteHeader(http.StatusForbidden)
+		return context.SendError(errForbidden)
+	}
+	return nil
+}
+
+func claimStrings(value interface{}, split bool) []string {
+	result := []string{}
+	switch value := value.(type) {
+	case string:
+		if split {
+			return strings.Fields(value)
+		}
+		return []string{value}
+	case []interface{}:
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+	case []string:
+		return value
+	}
+	return result
+}
+
+func containsAll(values, required []string) bool {
+	for _, item := range required {
+		found := false
+		for _, value := range values {
+			if value == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
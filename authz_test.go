@@ -0,0 +1,123 @@
+package magic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testPrincipal struct {
+	roles []string
+}
+
+func (principal testPrincipal) Roles() []string {
+	return principal.roles
+}
+
+// claimsFromHeader function
+// Test authentication middleware, set claims from header "X-Claims" like "sub=bob;roles=admin,editor;scope=read write"
+// Principal with roles is set from header "X-Principal-Roles"
+func claimsFromHeader() Middleware {
+	return NewMiddleware(func(context *Context) error {
+		if roles := context.Request.Header.Get("X-Principal-Roles"); roles != "" {
+			context.Storage[PrincipalKey] = testPrincipal{roles: strings.Split(roles, ",")}
+		}
+		value := context.Request.Header.Get("X-Claims")
+		if value == "" {
+			return nil
+		}
+		claims := map[string]interface{}{}
+		for _, pair := range strings.Split(value, ";") {
+			parts := strings.SplitN(pair, "=", 2)
+			if parts[0] == "roles" {
+				roles := []interface{}{}
+				for _, role := range strings.Split(parts[1], ",") {
+					roles = append(roles, role)
+				}
+				claims["roles"] = roles
+			} else {
+				claims[parts[0]] = parts[1]
+			}
+		}
+		context.Storage[ClaimsKey] = claims
+		return nil
+	})
+}
+
+func newAuthzTestRouter() *Router {
+	router := NewRouter()
+	router.Use(claimsFromHeader())
+	ok := func(context *Context) error {
+		return context.SendString("ok")
+	}
+	admin := router.mainRoute.CreateRoute("/admin", RequireRoles("admin"))
+	admin.GET("/users", ok)
+	admin.DELETE("/users", ok, RequireRoles("owner"))
+	router.mainRoute.GET("/reports", ok, RequireScopes("reports:read", "reports:list"))
+	router.mainRoute.GET("/users/:id", ok, RequirePolicy("self", PolicyFunc(func(context *Context) bool {
+		claims, _ := context.Storage[ClaimsKey].(map[string]interface{})
+		return claims["sub"] == context.Params["id"]
+	}))).Name("user")
+	return router
+}
+
+func TestRequirePermissions(t *testing.T) {
+	router := newAuthzTestRouter()
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		claims string
+		roles  string
+		code   int
+	}{
+		{"group role without claims", "GET", "/admin/users", "", "", http.StatusUnauthorized},
+		{"group role missed", "GET", "/admin/users", "sub=bob;roles=editor", "", http.StatusForbidden},
+		{"group role", "GET", "/admin/users", "sub=bob;roles=editor,admin", "", http.StatusOK},
+		{"group role of principal", "GET", "/admin/users", "", "admin", http.StatusOK},
+		{"handler role missed", "DELETE", "/admin/users", "roles=admin", "", http.StatusForbidden},
+		{"group and handler roles", "DELETE", "/admin/users", "roles=admin,owner", "", http.StatusOK},
+		{"scope without claims", "GET", "/reports", "", "", http.StatusUnauthorized},
+		{"scope missed", "GET", "/reports", "scope=reports:read", "", http.StatusForbidden},
+		{"scopes", "GET", "/reports", "scope=reports:list reports:read", "", http.StatusOK},
+		{"scopes in scp", "GET", "/reports", "scp=reports:read reports:list", "", http.StatusOK},
+		{"policy without claims", "GET", "/users/bob", "", "", http.StatusUnauthorized},
+		{"policy denies", "GET", "/users/alice", "sub=bob", "", http.StatusForbidden},
+		{"policy allows", "GET", "/users/bob", "sub=bob", "", http.StatusOK},
+	}
+	for _, test := range cases {
+		request := httptest.NewRequest(test.method, test.path, nil)
+		if test.claims != "" {
+			request.Header.Set("X-Claims", test.claims)
+		}
+		if test.roles != "" {
+			request.Header.Set("X-Principal-Roles", test.roles)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d %s", test.name, test.code, recorder.Code, recorder.Body.String())
+		}
+		challenge := recorder.Header().Get("WWW-Authenticate")
+		if test.code == http.StatusUnauthorized && (challenge != "Bearer" || !strings.Contains(recorder.Body.String(), errUnauthorized.Error())) {
+			t.Fatalf("%s: wrong 401 response %q %s", test.name, challenge, recorder.Body.String())
+		}
+		if test.code == http.StatusForbidden && (challenge != "" || !strings.Contains(recorder.Body.String(), errForbidden.Error())) {
+			t.Fatalf("%s: wrong 403 response %q %s", test.name, challenge, recorder.Body.String())
+		}
+	}
+}
+
+func TestRoutesPermissions(t *testing.T) {
+	expected := []RouteInfo{
+		{Method: "GET", Path: "/admin/users", Permissions: []string{"role:admin"}},
+		{Method: "DELETE", Path: "/admin/users", Permissions: []string{"role:admin", "role:owner"}},
+		{Method: "GET", Path: "/reports", Permissions: []string{"scope:reports:read", "scope:reports:list"}},
+		{Method: "GET", Path: "/users/:id", Name: "user", Permissions: []string{"policy:self"}},
+	}
+	if routes := newAuthzTestRouter().Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, routes)
+	}
+}
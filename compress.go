@@ -0,0 +1,303 @@
+package magic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// DefaultCompressContentTypes - content types which are compressed by default
+	DefaultCompressContentTypes = []string{
+		"text/",
+		"application/json",
+		"application/javascript",
+		"application/xml",
+		"application/x-javascript",
+		"application/wasm",
+		"image/svg+xml",
+	}
+	// DefaultCompressEncodings - supported encodings in order of preference
+	DefaultCompressEncodings = []string{"br", "zstd", "gzip", "deflate"}
+)
+
+// CompressConfig structure
+// MinSize - minimal size of body in bytes to compress (default 1024)
+// ContentTypes - prefixes of content types to compress (default DefaultCompressContentTypes)
+// Encodings - encodings in order of preference (default DefaultCompressEncodings)
+type CompressConfig struct {
+	MinSize      int
+	ContentTypes []string
+	Encodings    []string
+}
+
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(writer io.Writer)
+}
+
+// NewCompressMiddleware function
+// Create new response compression middleware
+// Encoding is chosen by Accept-Encoding, Vary header is always set
+// Range requests and responses with Content-Encoding are not compressed
+func NewCompressMiddleware(config CompressConfig) Middleware {
+	if config.MinSize <= 0 {
+		config.MinSize = 1024
+	}
+	if config.ContentTypes == nil {
+		config.ContentTypes = DefaultCompressContentTypes
+	}
+	if config.Encodings == nil {
+		config.Encodings = DefaultCompressEncodings
+	}
+	pools := make(map[string]*sync.Pool)
+	for _, encoding := range config.Encodings {
+		newEncoder := compressEncoders[encoding]
+		if newEncoder == nil {
+			panic(errEncoding.Error() + ": " + encoding)
+		}
+		pools[encoding] = &sync.Pool{
+			New: func() interface{} {
+				return newEncoder()
+			},
+		}
+	}
+
+	return NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) (err error) {
+			context.Writer.Header().Add("Vary", "Accept-Encoding")
+			if context.Request.Header.Get("Range") != "" || context.Request.Method == "HEAD" {
+				return next(context)
+			}
+			encoding := negotiateEncoding(context.Request.Header.Get("Accept-Encoding"), config.Encodings)
+			if encoding == "" {
+				return next(context)
+			}
+
+			writer := &compressWriter{
+				ResponseWriter: context.Writer,
+				config:         &config,
+				encoding:       encoding,
+				pool:           pools[encoding],
+				status:         http.StatusOK,
+			}
+			original := context.Writer
+			context.Writer = writer
+			// writer is closed also on panic, so recover middleware before it sends 500 to client
+			defer func() {
+				context.Writer = original
+				if closeErr := writer.close(); err == nil {
+					err = closeErr
+				}
+			}()
+			return next(context)
+		}
+	})
+}
+
+var compressEncoders = map[string]func() compressEncoder{
+	"gzip": func() compressEncoder {
+		return gzip.NewWriter(nil)
+	},
+	"deflate": func() compressEncoder {
+		return zlib.NewWriter(nil)
+	},
+	"br": func() compressEncoder {
+		return brotli.NewWriter(nil)
+	},
+	"zstd": func() compressEncoder {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return encoder
+	},
+}
+
+// negotiateEncoding function
+// Return encoding with highest q value from Accept-Encoding, encodings order breaks ties
+func negotiateEncoding(acceptEncoding string, encodings []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					quality = q
+				}
+			}
+		}
+		qualities[name] = quality
+	}
+
+	result := ""
+	best := 0.0
+	for _, encoding := range encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > best {
+			result = encoding
+			best = quality
+		}
+	}
+	return result
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	config      *CompressConfig
+	encoding    string
+	pool        *sync.Pool
+	encoder     compressEncoder
+	buffer      []byte
+	size        int64
+	status      int
+	decided     bool
+	wroteHeader bool
+}
+
+func (writer *compressWriter) WriteHeader(status int) {
+	if writer.wroteHeader {
+		return
+	}
+	writer.wroteHeader = true
+	writer.status = status
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		writer.decide(false)
+	}
+}
+
+func (writer *compressWriter) Write(bytes []byte) (int, error) {
+	writer.wroteHeader = true
+	writer.size += int64(len(bytes))
+	if !writer.decided {
+		writer.buffer = append(writer.buffer, bytes...)
+		if len(writer.buffer) < writer.config.MinSize {
+			return len(bytes), nil
+		}
+		if err := writer.decide(true); err != nil {
+			return 0, err
+		}
+		return len(bytes), nil
+	}
+	if writer.encoder != nil {
+		return writer.encoder.Write(bytes)
+	}
+	return writer.ResponseWriter.Write(bytes)
+}
+
+// acceptedSize function
+// Return count of body bytes written by handler, also buffered ones
+func (writer *compressWriter) acceptedSize() int64 {
+	return writer.size
+}
+
+// decide function
+// Choose compress or not and send headers with buffered body
+func (writer *compressWriter) decide(compress bool) error {
+	writer.decided = true
+	header := writer.ResponseWriter.Header()
+	if header.Get("Content-Type") == "" && len(writer.buffer) != 0 {
+		header.Set("Content-Type", http.DetectContentType(writer.buffer))
+	}
+	compress = compress && header.Get("Content-Encoding") == "" &&
+		compressibleContentType(header.Get("Content-Type"), writer.config.ContentTypes)
+
+	if compress {
+		header.Set("Content-Encoding", writer.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		writer.encoder = writer.pool.Get().(compressEncoder)
+		writer.encoder.Reset(writer.ResponseWriter)
+	}
+	writer.ResponseWriter.WriteHeader(writer.status)
+
+	buffer := writer.buffer
+	writer.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if writer.encoder != nil {
+		_, err = writer.encoder.Write(buffer)
+	} else {
+		_, err = writer.ResponseWriter.Write(buffer)
+	}
+	return err
+}
+
+func (writer *compressWriter) Flush() {
+	if !writer.decided {
+		writer.decide(true)
+	}
+	if writer.encoder != nil {
+		writer.encoder.Flush()
+	}
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (writer *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := writer.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijack
+	}
+	writer.decided = true
+	return hijacker.Hijack()
+}
+
+func (writer *compressWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+func (writer *compressWriter) close() error {
+	if !writer.decided {
+		if !writer.wroteHeader {
+			return nil
+		}
+		if err := writer.decide(false); err != nil {
+			return err
+		}
+	}
+	if writer.encoder == nil {
+		return nil
+	}
+	err := writer.encoder.Close()
+	writer.encoder.Reset(nil)
+	writer.pool.Put(writer.encoder)
+	writer.encoder = nil
+	return err
+}
+
+func compressibleContentType(contentType string, contentTypes []string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, prefix := range contentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
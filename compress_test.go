@@ -0,0 +1,162 @@
+package magic
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var compressTestBody = strings.Repeat("magic ", 300)
+
+// serveCompress function
+// Send GET request with Accept-Encoding and other headers through router and return response
+func serveCompress(router *Router, path, acceptEncoding string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", path, nil)
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func gunzipBody(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	t.Helper()
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, br", "br"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"GZIP", "gzip"},
+		{"*", "br"},
+		{"br;q=0, *;q=0.1", "zstd"},
+		{"identity", ""},
+		{"gzip;q=0", ""},
+	}
+	for _, test := range cases {
+		if encoding := negotiateEncoding(test.acceptEncoding, DefaultCompressEncodings); encoding != test.encoding {
+			t.Fatalf("%q: expected %q, got %q", test.acceptEncoding, test.encoding, encoding)
+		}
+	}
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	router := NewRouter()
+	router.Use(NewCompressMiddleware(CompressConfig{MinSize: 100}))
+	router.mainRoute.GET("/large", func(context *Context) error {
+		return context.SendString(compressTestBody)
+	})
+	router.mainRoute.GET("/small", func(context *Context) error {
+		return context.SendString("small")
+	})
+
+	recorder := serveCompress(router, "/large", "gzip", nil)
+	if recorder.Header().Get("Content-Encoding") != "gzip" || recorder.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected gzip response with Vary, got %v", recorder.Header())
+	}
+	if body := gunzipBody(t, recorder); body != compressTestBody {
+		t.Fatalf("wrong decompressed body: %q", body)
+	}
+
+	cases := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		headers        map[string]string
+	}{
+		{"smaller than MinSize", "/small", "gzip", nil},
+		{"without Accept-Encoding", "/large", "", nil},
+		{"unsupported encoding", "/large", "compress", nil},
+		{"range request", "/large", "gzip", map[string]string{"Range": "bytes=0-10"}},
+	}
+	for _, test := range cases {
+		recorder := serveCompress(router, test.path, test.acceptEncoding, test.headers)
+		if encoding := recorder.Header().Get("Content-Encoding"); encoding != "" {
+			t.Fatalf("%s: expected plain response, got %q", test.name, encoding)
+		}
+		if recorder.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s: Vary is missed", test.name)
+		}
+		if test.path == "/small" && recorder.Body.String() != "small" {
+			t.Fatalf("%s: wrong body %q", test.name, recorder.Body.String())
+		}
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	router := NewRouter()
+	router.Use(NewCompressMiddleware(CompressConfig{}))
+	var flushed int64
+	router.mainRoute.GET("/stream", func(context *Context) error {
+		context.Writer.Write([]byte("first event\n"))
+		context.Writer.(http.Flusher).Flush()
+		flushed = context.Response.Size()
+		context.Writer.Write([]byte("second event\n"))
+		return nil
+	})
+	recorder := serveCompress(router, "/stream", "gzip", nil)
+	if flushed == 0 || !recorder.Flushed {
+		t.Fatal("small body is not flushed")
+	}
+	if body := gunzipBody(t, recorder); body != "first event\nsecond event\n" {
+		t.Fatalf("wrong streamed body: %q", body)
+	}
+}
+
+func TestCompressPanicRecovered(t *testing.T) {
+	router := NewRouter()
+	router.Use(NewRecoverMiddleware())
+	router.Use(NewCompressMiddleware(CompressConfig{}))
+	router.mainRoute.GET("/panic", func(context *Context) error {
+		panic("handler failed")
+	})
+	recorder := serveCompress(router, "/panic", "gzip", nil)
+	if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), "internal server error") {
+		t.Fatalf("expected 500 with error, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestCompressPartialWriteGuard(t *testing.T) {
+	router := NewRouter()
+	router.Use(NewCompressMiddleware(CompressConfig{}))
+	router.mainRoute.GET("/partial", func(context *Context) error {
+		context.Writer.Write([]byte(`{"items": [`))
+		context.Writer.WriteHeader(http.StatusInternalServerError)
+		return context.SendErrorString("failed in the middle")
+	})
+	router.mainRoute.GET("/error", func(context *Context) error {
+		context.Writer.WriteHeader(http.StatusBadRequest)
+		return context.SendErrorString("bad request")
+	})
+
+	recorder := serveCompress(router, "/partial", "gzip", nil)
+	if body := recorder.Body.String(); body != `{"items": [` {
+		t.Fatalf("error is appended to partial body: %q", body)
+	}
+
+	recorder = serveCompress(router, "/error", "gzip", nil)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "bad request") {
+		t.Fatalf("expected error response, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 )
 
 // Context structure
-// Writer - standert ResponseWriter
+// Writer - standert ResponseWriter, by default it is Response
+// Response - wrapper of ResponseWriter with status, size and write state
 // Request - standart Request
 // Body - all in body
 // Params - params in url (/:id)
@@ -22,8 +24,11 @@ import (
 // FileParams - all files
 // Headers - standart headers
 // Storage - storage for all; transfer data middleware -> middleware -> ... -> handler
+// Route - matched route, nil if route not found
+// RequestID - id of request, set by request id middleware
 type Context struct {
 	Writer          http.ResponseWriter
+	Response        *Response
 	Request         *http.Request
 	Body            string
 	Params          Values
@@ -33,13 +38,46 @@ type Context struct {
 	FileParams      FilesArr
 	Headers         ValuesArr
 	Storage         map[string]interface{}
+	Route           *Route
+	RequestID       string
+	span            Span
+	router          *Router
+}
+
+// bodyStarted function
+// Return true if some writer of chain already accepted part of body
+// Writers like compress writer buffer body, so Response.Size() can be 0
+func (context *Context) bodyStarted() bool {
+	writer := context.Writer
+	for writer != nil {
+		if sized, ok := writer.(interface{ acceptedSize() int64 }); ok && sized.acceptedSize() > 0 {
+			return true
+		}
+		if response, ok := writer.(*Response); ok {
+			return response.Size() > 0
+		}
+		unwrapper, ok := writer.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		writer = unwrapper.Unwrap()
+	}
+	return context.Response != nil && context.Response.Size() > 0
 }
 
 // SendError function
 // send your error like {"message": "error message"}
+// If context has request id it is added like {"message": "error message", "request_id": "id"}
+// Nothing is sent if body already partially written
 func (context *Context) SendError(err error) error {
+	if context.bodyStarted() {
+		return err
+	}
 	message := make(map[string]interface{})
 	message["message"] = err.Error()
+	if context.RequestID != "" {
+		message["request_id"] = context.RequestID
+	}
 	str, _ := json.MarshalIndent(message, "", "    ")
 	fmt.Fprint(context.Writer, string(str))
 	return err
@@ -47,9 +85,17 @@ func (context *Context) SendError(err error) error {
 
 // SendErrorString function
 // Send your error like {"message": "your string"}
+// If context has request id it is added like {"message": "your string", "request_id": "id"}
+// Nothing is sent if body already partially written
 func (context *Context) SendErrorString(errorStr string) error {
+	if context.bodyStarted() {
+		return errors.New(errorStr)
+	}
 	message := make(map[string]interface{})
 	message["message"] = errorStr
+	if context.RequestID != "" {
+		message["request_id"] = context.RequestID
+	}
 	str, _ := json.MarshalIndent(message, "", "    ")
 	fmt.Fprint(context.Writer, string(str))
 	return errors.New(errorStr)
@@ -91,6 +137,40 @@ func (context *Context) SendFileBytes(fileName string, bytes []byte) error {
 	return context.SendString(string(bytes))
 }
 
+// RealIP function
+// Return ip of client
+// X-Forwarded-For and X-Real-IP are used only if request comes from proxy of magic.SetTrustedProxies,
+// then right-most ip of X-Forwarded-For which is not trusted proxy is returned
+func (context *Context) RealIP() string {
+	host, _, err := net.SplitHostPort(context.Request.RemoteAddr)
+	if err != nil {
+		host = context.Request.RemoteAddr
+	}
+	if context.router == nil || !context.router.isTrustedProxy(host) {
+		return host
+	}
+	hops := []string{}
+	for _, forwarded := range context.Request.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(forwarded, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	if len(hops) == 0 {
+		if realIP := strings.TrimSpace(context.Request.Header.Get("X-Real-IP")); realIP != "" {
+			return realIP
+		}
+		return host
+	}
+	for i := len(hops) - 1; i > 0; i-- {
+		if !context.router.isTrustedProxy(hops[i]) {
+			return hops[i]
+		}
+	}
+	return hops[0]
+}
+
 // ParseJSON function
 // Parse JSON in body to your interface
 func (context *Context) ParseJSON(iface interface{}) error {
@@ -309,9 +389,11 @@ func (filesArr FilesArr) ParseFile(key string) ([]byte, string, error) {
 }
 
 func getContext(writer http.ResponseWriter, request *http.Request) *Context {
+	response := NewResponse(writer)
 	context := Context{
-		Writer:  writer,
-		Request: request,
+		Writer:   response,
+		Response: response,
+		Request:  request,
 	}
 	context.Storage = make(map[string]interface{})
 	return &context
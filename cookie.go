@@ -0,0 +1,271 @@
+package magic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errCookieValue   = errors.New("invalid cookie value")
+	errCookieExpired = errors.New("cookie is expired")
+	errCookieKeys    = errors.New("cookie config has no keys")
+)
+
+// CookieConfig structure
+// Defaults of cookies set by context.SetCookie, context.SetSignedCookie and context.SetEncryptedCookie
+// Path, Domain, HttpOnly, Secure, SameSite - attributes of cookie
+// HashKeys - HMAC keys of signed cookies, first key signs, all keys verify (for rotation)
+// EncryptionKeys - AES keys (16, 24 or 32 bytes) of encrypted cookies, first key encrypts, all keys decrypt
+type CookieConfig struct {
+	Path           string
+	Domain         string
+	HttpOnly       bool
+	Secure         bool
+	SameSite       http.SameSite
+	HashKeys       [][]byte
+	EncryptionKeys [][]byte
+}
+
+// DefaultCookieConfig function
+// Return config with path "/", HttpOnly, Secure and SameSite Lax, without keys
+func DefaultCookieConfig() CookieConfig {
+	return CookieConfig{
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// SetCookie function
+// Set cookie with defaults of magic.SetCookieConfig
+// Cookie lives until browser is closed if maxAge is 0
+func (context *Context) SetCookie(name, value string, maxAge time.Duration) {
+	config := context.cookieConfig()
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     config.Path,
+		Domain:   config.Domain,
+		HttpOnly: config.HttpOnly,
+		Secure:   config.Secure,
+		SameSite: config.SameSite,
+	}
+	if maxAge > 0 {
+		cookie.MaxAge = int(maxAge.Seconds())
+		cookie.Expires = time.Now().Add(maxAge)
+	}
+	http.SetCookie(context.Writer, cookie)
+}
+
+// Cookie function
+// Return value of cookie, http.ErrNoCookie if there is no cookie
+func (context *Context) Cookie(name string) (string, error) {
+	cookie, err := context.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// DeleteCookie function
+// Delete cookie with path and domain of magic.SetCookieConfig
+func (context *Context) DeleteCookie(name string) {
+	config := context.cookieConfig()
+	http.SetCookie(context.Writer, &http.Cookie{
+		Name:     name,
+		Path:     config.Path,
+		Domain:   config.Domain,
+		MaxAge:   -1,
+		HttpOnly: config.HttpOnly,
+		Secure:   config.Secure,
+		SameSite: config.SameSite,
+	})
+}
+
+// SetSignedCookie function
+// Set cookie with HMAC-SHA256 by first of CookieConfig.HashKeys
+// Value can be any string, expiration time is signed too
+func (context *Context) SetSignedCookie(name, value string, maxAge time.Duration) error {
+	keys := context.cookieConfig().HashKeys
+	if len(keys) == 0 {
+		return errCookieKeys
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(cookiePayload(value, maxAge)))
+	context.SetCookie(name, signCookieValue(keys, name, payload), maxAge)
+	return nil
+}
+
+// SignedCookie function
+// Return value of cookie set by SetSignedCookie
+// Return error if cookie is missed, changed, signed by unknown key or expired
+func (context *Context) SignedCookie(name string) (string, error) {
+	keys := context.cookieConfig().HashKeys
+	if len(keys) == 0 {
+		return "", errCookieKeys
+	}
+	signed, err := context.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	payload, err := verifyCookieValue(keys, name, signed)
+	if err != nil {
+		return "", err
+	}
+	bytes, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", errCookieValue
+	}
+	return parseCookiePayload(string(bytes), time.Now())
+}
+
+// SetEncryptedCookie function
+// Set cookie encrypted by AES-GCM with first of CookieConfig.EncryptionKeys
+// Client can't read or change value, expiration time is encrypted too
+func (context *Context) SetEncryptedCookie(name, value string, maxAge time.Duration) error {
+	keys := context.cookieConfig().EncryptionKeys
+	if len(keys) == 0 {
+		return errCookieKeys
+	}
+	encrypted, err := encryptCookieValue(keys, name, []byte(cookiePayload(value, maxAge)))
+	if err != nil {
+		return err
+	}
+	context.SetCookie(name, encrypted, maxAge)
+	return nil
+}
+
+// EncryptedCookie function
+// Return value of cookie set by SetEncryptedCookie
+// Return error if cookie is missed, changed, encrypted by unknown key or expired
+func (context *Context) EncryptedCookie(name string) (string, error) {
+	keys := context.cookieConfig().EncryptionKeys
+	if len(keys) == 0 {
+		return "", errCookieKeys
+	}
+	encrypted, err := context.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	bytes, err := decryptCookieValue(keys, name, encrypted)
+	if err != nil {
+		return "", err
+	}
+	return parseCookiePayload(string(bytes), time.Now())
+}
+
+func (context *Context) cookieConfig() CookieConfig {
+	if context.router == nil {
+		return DefaultCookieConfig()
+	}
+	return context.router.cookieConfig
+}
+
+// cookiePayload function
+// Return "expires|value", expires is 0 for cookie without maxAge
+func cookiePayload(value string, maxAge time.Duration) string {
+	expires := int64(0)
+	if maxAge > 0 {
+		expires = time.Now().Add(maxAge).Unix()
+	}
+	return strconv.FormatInt(expires, 10) + "|" + value
+}
+
+func parseCookiePayload(payload string, now time.Time) (string, error) {
+	mas := strings.SplitN(payload, "|", 2)
+	if len(mas) != 2 {
+		return "", errCookieValue
+	}
+	expires, err := strconv.ParseInt(mas[0], 10, 64)
+	if err != nil {
+		return "", errCookieValue
+	}
+	if expires != 0 && now.Unix() >= expires {
+		return "", errCookieExpired
+	}
+	return mas[1], nil
+}
+
+// signCookieValue function
+// Return "value.mac" with HMAC-SHA256 of name and value by first key
+func signCookieValue(keys [][]byte, name, value string) string {
+	return value + "." + base64.RawURLEncoding.EncodeToString(cookieMAC(keys[0], name, value))
+}
+
+// verifyCookieValue function
+// Check mac of "value.mac" by all keys and return value
+func verifyCookieValue(keys [][]byte, name, signed string) (string, error) {
+	index := strings.LastIndexByte(signed, '.')
+	if index < 0 {
+		return "", errCookieValue
+	}
+	value := signed[:index]
+	mac, err := base64.RawURLEncoding.DecodeString(signed[index+1:])
+	if err != nil {
+		return "", errCookieValue
+	}
+	for _, key := range keys {
+		if hmac.Equal(mac, cookieMAC(key, name, value)) {
+			return value, nil
+		}
+	}
+	return "", errCookieValue
+}
+
+func cookieMAC(key []byte, name, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "=" + value))
+	return mac.Sum(nil)
+}
+
+// encryptCookieValue function
+// Encrypt value by AES-GCM with first key, name of cookie is authenticated too
+func encryptCookieValue(keys [][]byte, name string, value []byte) (string, error) {
+	aead, err := cookieAEAD(keys[0])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, value, []byte(name))), nil
+}
+
+// decryptCookieValue function
+// Decrypt value by first key which can do it
+func decryptCookieValue(keys [][]byte, name, encrypted string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, errCookieValue
+	}
+	for _, key := range keys {
+		aead, err := cookieAEAD(key)
+		if err != nil || len(data) < aead.NonceSize() {
+			continue
+		}
+		nonce := data[:aead.NonceSize()]
+		value, err := aead.Open(nil, nonce, data[aead.NonceSize():], []byte(name))
+		if err == nil {
+			return value, nil
+		}
+	}
+	return nil, errCookieValue
+}
+
+func cookieAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,163 @@
+package magic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCookieTestRouter(hashKeys, encryptionKeys [][]byte) *Router {
+	router := NewRouter()
+	config := DefaultCookieConfig()
+	config.HashKeys = hashKeys
+	config.EncryptionKeys = encryptionKeys
+	router.SetCookieConfig(config)
+	router.mainRoute.GET("/set", func(context *Context) error {
+		value := context.Request.URL.Query().Get("value")
+		if err := context.SetSignedCookie("signed", value, time.Hour); err != nil {
+			return context.SendError(err)
+		}
+		if err := context.SetEncryptedCookie("encrypted", value, 0); err != nil {
+			return context.SendError(err)
+		}
+		return context.SendString("ok")
+	})
+	router.mainRoute.GET("/get", func(context *Context) error {
+		signed, err := context.SignedCookie("signed")
+		if err != nil {
+			signed = err.Error()
+		}
+		encrypted, err := context.EncryptedCookie("encrypted")
+		if err != nil {
+			encrypted = err.Error()
+		}
+		return context.SendString(signed + "|" + encrypted)
+	})
+	return router
+}
+
+// serveCookies function
+// Send request with cookies and return response
+func serveCookies(router *Router, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", path, nil)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestSignedAndEncryptedCookies(t *testing.T) {
+	router := newCookieTestRouter([][]byte{[]byte("hash key")}, [][]byte{[]byte("0123456789abcdef")})
+	cookies := serveCookies(router, "/set?value=user%7Cbob", nil).Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies, got %d", len(cookies))
+	}
+	signed, encrypted := cookies[0], cookies[1]
+	if signed.MaxAge != 3600 || !signed.Secure || !signed.HttpOnly || encrypted.MaxAge != 0 {
+		t.Fatalf("cookies don't use defaults: %+v %+v", signed, encrypted)
+	}
+	if strings.Contains(encrypted.Value, "bob") {
+		t.Fatalf("encrypted cookie is readable: %s", encrypted.Value)
+	}
+	if body := serveCookies(router, "/get", cookies).Body.String(); body != "user|bob|user|bob" {
+		t.Fatalf("wrong cookie values %q", body)
+	}
+
+	tamper := func(cookie *http.Cookie, change func(string) string) *http.Cookie {
+		changed := *cookie
+		changed.Value = change(cookie.Value)
+		return &changed
+	}
+	cases := []struct {
+		name    string
+		cookies []*http.Cookie
+		body    string
+	}{
+		{"missed", nil, http.ErrNoCookie.Error() + "|" + http.ErrNoCookie.Error()},
+		{"changed value", []*http.Cookie{
+			tamper(signed, func(value string) string { return "x" + value }),
+			tamper(encrypted, func(value string) string {
+				if value[0] == 'A' {
+					return "B" + value[1:]
+				}
+				return "A" + value[1:]
+			}),
+		}, errCookieValue.Error() + "|" + errCookieValue.Error()},
+		{"without mac", []*http.Cookie{
+			tamper(signed, func(value string) string { return value[:strings.LastIndexByte(value, '.')] }),
+			tamper(encrypted, func(value string) string { return value[:10] }),
+		}, errCookieValue.Error() + "|" + errCookieValue.Error()},
+		{"value of other cookie", []*http.Cookie{
+			{Name: "signed", Value: encrypted.Value},
+			{Name: "encrypted", Value: signed.Value},
+		}, errCookieValue.Error() + "|" + errCookieValue.Error()},
+	}
+	for _, test := range cases {
+		if body := serveCookies(router, "/get", test.cookies).Body.String(); body != test.body {
+			t.Fatalf("%s: expected %q, got %q", test.name, test.body, body)
+		}
+	}
+}
+
+func TestCookieKeyRotation(t *testing.T) {
+	oldHash, newHash := []byte("old hash key"), []byte("new hash key")
+	oldAES, newAES := []byte("old key 16 bytes"), []byte("new key 16 bytes")
+	oldCookies := serveCookies(newCookieTestRouter([][]byte{oldHash}, [][]byte{oldAES}), "/set?value=bob", nil).Result().Cookies()
+
+	rotated := newCookieTestRouter([][]byte{newHash, oldHash}, [][]byte{newAES, oldAES})
+	if body := serveCookies(rotated, "/get", oldCookies).Body.String(); body != "bob|bob" {
+		t.Fatalf("old key doesn't verify after rotation: %q", body)
+	}
+	newCookies := serveCookies(rotated, "/set?value=alice", nil).Result().Cookies()
+	onlyNew := newCookieTestRouter([][]byte{newHash}, [][]byte{newAES})
+	if body := serveCookies(onlyNew, "/get", newCookies).Body.String(); body != "alice|alice" {
+		t.Fatalf("cookie is not set by first key: %q", body)
+	}
+	expected := errCookieValue.Error() + "|" + errCookieValue.Error()
+	if body := serveCookies(onlyNew, "/get", oldCookies).Body.String(); body != expected {
+		t.Fatalf("removed key still verifies: %q", body)
+	}
+}
+
+func TestCookieExpiry(t *testing.T) {
+	now := time.Now()
+	payload := cookiePayload("bob", time.Minute)
+	if value, err := parseCookiePayload(payload, now); err != nil || value != "bob" {
+		t.Fatalf("expected bob, got %q %v", value, err)
+	}
+	if _, err := parseCookiePayload(payload, now.Add(2*time.Minute)); err != errCookieExpired {
+		t.Fatalf("expected %q, got %v", errCookieExpired, err)
+	}
+	if value, err := parseCookiePayload(cookiePayload("bob", 0), now.Add(1000*time.Hour)); err != nil || value != "bob" {
+		t.Fatalf("session cookie is expired: %q %v", value, err)
+	}
+
+	router := newCookieTestRouter([][]byte{[]byte("hash key")}, nil)
+	keys := router.cookieConfig.HashKeys
+	expired := signCookieValue(keys, "signed", "MTAwfGJvYg") // "100|bob"
+	body := serveCookies(router, "/get", []*http.Cookie{{Name: "signed", Value: expired}}).Body.String()
+	if !strings.HasPrefix(body, errCookieExpired.Error()+"|") {
+		t.Fatalf("expired cookie is accepted: %q", body)
+	}
+}
+
+func TestCookiesWithoutKeys(t *testing.T) {
+	router := newCookieTestRouter(nil, nil)
+	if body := serveCookies(router, "/set?value=bob", nil).Body.String(); !strings.Contains(body, errCookieKeys.Error()) {
+		t.Fatalf("expected %q, got %q", errCookieKeys, body)
+	}
+	if body := serveCookies(router, "/get", nil).Body.String(); body != errCookieKeys.Error()+"|"+errCookieKeys.Error() {
+		t.Fatalf("expected %q, got %q", errCookieKeys, body)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on invalid encryption key")
+		}
+	}()
+	newCookieTestRouter(nil, [][]byte{[]byte("short")})
+}
@@ -0,0 +1,215 @@
+package magic
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CSRF modes
+const (
+	CSRFDoubleSubmit = "double_submit"
+	CSRFSynchronizer = "synchronizer"
+)
+
+var (
+	errCSRFMode    = errors.New("unsupported CSRF mode")
+	errCSRFSession = errors.New("CSRF synchronizer mode needs session middleware")
+	errCSRFKeys    = errors.New("CSRF double submit mode needs HashKeys in magic.SetCookieConfig")
+	errCSRFToken   = errors.New("miss or invalid CSRF token")
+	errCSRFOrigin  = errors.New("invalid origin of request")
+)
+
+const (
+	csrfKey        = "magic.csrf"
+	csrfSecretSize = 32
+)
+
+// CSRFConfig structure
+// Mode - CSRFDoubleSubmit keeps token in cookie, CSRFSynchronizer keeps it in session of NewSessionMiddleware (default CSRFDoubleSubmit)
+// CookieName - cookie with token in CSRFDoubleSubmit mode (default "_csrf"), it is set by context.SetSignedCookie,
+// so HashKeys of magic.SetCookieConfig are required
+// FieldName - form field with token (default "csrf_token")
+// HeaderName - header with token (default "X-CSRF-Token")
+// TrustedOrigins - other origins which can send requests like "https://admin.example.com"
+// Exempt - routes without checks like "/webhooks/stripe" or "/webhooks/*", compared with route pattern and path
+type CSRFConfig struct {
+	Mode           string
+	CookieName     string
+	FieldName      string
+	HeaderName     string
+	TrustedOrigins []string
+	Exempt         []string
+}
+
+// NewCSRFMiddleware function
+// Create new CSRF protection middleware, get token for forms by context.CSRFToken()
+// POST, PUT, DELETE and other unsafe requests must have token in form field or header
+// and Origin (or Referer) of this host or trusted origin
+// Send 403 if check fails
+func NewCSRFMiddleware(config CSRFConfig) Middleware {
+	if config.Mode == "" {
+		config.Mode = CSRFDoubleSubmit
+	}
+	if config.Mode != CSRFDoubleSubmit && config.Mode != CSRFSynchronizer {
+		panic(errCSRFMode.Error() + ": " + config.Mode)
+	}
+	if config.CookieName == "" {
+		config.CookieName = "_csrf"
+	}
+	if config.FieldName == "" {
+		config.FieldName = "csrf_token"
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "X-CSRF-Token"
+	}
+	return NewMiddleware(func(context *Context) error {
+		if csrfExempt(context, config.Exempt) {
+			return nil
+		}
+		secret, err := csrfSecret(context, config)
+		if err != nil {
+			context.Writer.WriteHeader(http.StatusInternalServerError)
+			return context.SendError(err)
+		}
+		context.Storage[csrfKey] = secret
+
+		switch context.Request.Method {
+		case "GET", "HEAD", "OPTIONS", "TRACE":
+			return nil
+		}
+		if !csrfOriginAllowed(context.Request, config.TrustedOrigins) {
+			context.Writer.WriteHeader(http.StatusForbidden)
+			return context.SendError(errCSRFOrigin)
+		}
+		token := context.Request.Header.Get(config.HeaderName)
+		if token == "" {
+			token = context.Request.PostFormValue(config.FieldName)
+		}
+		if !csrfTokenValid(token, secret) {
+			context.Writer.WriteHeader(http.StatusForbidden)
+			return context.SendError(errCSRFToken)
+		}
+		return nil
+	})
+}
+
+// CSRFToken function
+// Return token for form field or header, it is different for every call (masked against BREACH)
+// Return empty string if there is no CSRF middleware
+func (context *Context) CSRFToken() string {
+	secret, ok := context.Storage[csrfKey].([]byte)
+	if !ok {
+		return ""
+	}
+	token := make([]byte, 2*csrfSecretSize)
+	rand.Read(token[:csrfSecretSize])
+	for i := range secret {
+		token[csrfSecretSize+i] = token[i] ^ secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// csrfSecret function
+// Return secret of client from cookie or session, create new if there is no
+func csrfSecret(context *Context, config CSRFConfig) ([]byte, error) {
+	if config.Mode == CSRFSynchronizer {
+		session := context.Session()
+		if session == nil {
+			return nil, errCSRFSession
+		}
+		value, _ := session.Get(csrfKey).(string)
+		secret, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(secret) != csrfSecretSize {
+			secret = newCSRFSecret()
+			session.Set(csrfKey, base64.RawURLEncoding.EncodeToString(secret))
+		}
+		return secret, nil
+	}
+	value, err := context.SignedCookie(config.CookieName)
+	if err == errCookieKeys {
+		return nil, errCSRFKeys
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(secret) != csrfSecretSize {
+		secret = newCSRFSecret()
+		if err := context.SetSignedCookie(config.CookieName, base64.RawURLEncoding.EncodeToString(secret), 0); err != nil {
+			return nil, err
+		}
+	}
+	return secret, nil
+}
+
+func newCSRFSecret() []byte {
+	secret := make([]byte, csrfSecretSize)
+	rand.Read(secret)
+	return secret
+}
+
+// csrfTokenValid function
+// Unmask token from CSRFToken and compare it with secret in constant time
+func csrfTokenValid(token string, secret []byte) bool {
+	bytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(bytes) != 2*csrfSecretSize {
+		return false
+	}
+	unmasked := make([]byte, csrfSecretSize)
+	for i := range unmasked {
+		unmasked[i] = bytes[i] ^ bytes[csrfSecretSize+i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
+
+// csrfOriginAllowed function
+// Check Origin or Referer if Origin is missed
+// Request without both headers is allowed only over HTTP, browsers send them over HTTPS
+func csrfOriginAllowed(request *http.Request, trustedOrigins []string) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		referer := request.Header.Get("Referer")
+		if referer == "" {
+			return request.TLS == nil
+		}
+		refererURL, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+		origin = refererURL.Scheme + "://" + refererURL.Host
+	}
+	for _, trusted := range trustedOrigins {
+		if strings.EqualFold(origin, trusted) {
+			return true
+		}
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil || originURL.Host == "" {
+		return false
+	}
+	return strings.EqualFold(originURL.Host, request.Host)
+}
+
+// csrfExempt function
+// Return true if route pattern or path matches one of patterns, "/a/*" matches all paths under "/a/"
+func csrfExempt(context *Context, patterns []string) bool {
+	path := context.Request.URL.Path
+	fullPath := ""
+	if context.Route != nil {
+		fullPath = context.Route.FullPath()
+	}
+	for _, pattern := range patterns {
+		if pattern == path || pattern == fullPath {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") {
+			prefix := strings.TrimSuffix(pattern, "*")
+			if strings.HasPrefix(path, prefix) || (fullPath != "" && strings.HasPrefix(fullPath, prefix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
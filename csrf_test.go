@@ -0,0 +1,122 @@
+package magic
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newCSRFTestRouter(mode string) *Router {
+	router := NewRouter()
+	config := DefaultCookieConfig()
+	config.HashKeys = [][]byte{[]byte("cookie key")}
+	router.SetCookieConfig(config)
+	if mode == CSRFSynchronizer {
+		router.Use(NewSessionMiddleware(SessionConfig{HashKeys: [][]byte{[]byte("session key")}}))
+	}
+	router.Use(NewCSRFMiddleware(CSRFConfig{Mode: mode, Exempt: []string{"/webhooks/*"}}))
+	router.mainRoute.GET("/form", func(context *Context) error {
+		return context.SendString(context.CSRFToken())
+	})
+	router.mainRoute.POST("/submit", func(context *Context) error {
+		return context.SendString("submitted")
+	})
+	router.mainRoute.POST("/webhooks/:name", func(context *Context) error {
+		return context.SendString("webhook")
+	})
+	return router
+}
+
+type csrfRequest struct {
+	path    string
+	form    url.Values
+	header  string
+	origin  string
+	cookies []*http.Cookie
+}
+
+func serveCSRF(router *Router, test csrfRequest) *httptest.ResponseRecorder {
+	if test.path == "" {
+		test.path = "/submit"
+	}
+	request := httptest.NewRequest("POST", test.path, strings.NewReader(test.form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if test.header != "" {
+		request.Header.Set("X-CSRF-Token", test.header)
+	}
+	if test.origin != "" {
+		request.Header.Set("Origin", test.origin)
+	}
+	for _, cookie := range test.cookies {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	for _, mode := range []string{CSRFDoubleSubmit, CSRFSynchronizer} {
+		t.Run(mode, func(t *testing.T) {
+			router := newCSRFTestRouter(mode)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("GET", "/form", nil))
+			token := recorder.Body.String()
+			cookies := recorder.Result().Cookies()
+
+			cases := []struct {
+				name    string
+				request csrfRequest
+				code    int
+				err     error
+			}{
+				{"token in form", csrfRequest{form: url.Values{"csrf_token": {token}}, origin: "http://example.com", cookies: cookies}, http.StatusOK, nil},
+				{"token in header", csrfRequest{header: token, cookies: cookies}, http.StatusOK, nil},
+				{"missing token", csrfRequest{cookies: cookies}, http.StatusForbidden, errCSRFToken},
+				{"bad token", csrfRequest{form: url.Values{"csrf_token": {"bad"}}, cookies: cookies}, http.StatusForbidden, errCSRFToken},
+				{"token without cookie", csrfRequest{form: url.Values{"csrf_token": {token}}}, http.StatusForbidden, errCSRFToken},
+				{"bad origin", csrfRequest{form: url.Values{"csrf_token": {token}}, origin: "http://evil.com", cookies: cookies}, http.StatusForbidden, errCSRFOrigin},
+				{"exempt route", csrfRequest{path: "/webhooks/stripe", origin: "https://stripe.com"}, http.StatusOK, nil},
+			}
+			for _, test := range cases {
+				recorder := serveCSRF(router, test.request)
+				if recorder.Code != test.code {
+					t.Fatalf("%s: expected %d, got %d %s", test.name, test.code, recorder.Code, recorder.Body.String())
+				}
+				if test.err != nil && !strings.Contains(recorder.Body.String(), test.err.Error()) {
+					t.Fatalf("%s: expected %q, got %s", test.name, test.err, recorder.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCSRFDoubleSubmitRejectsUnsignedCookie(t *testing.T) {
+	router := newCSRFTestRouter(CSRFDoubleSubmit)
+	secret := make([]byte, csrfSecretSize)
+	context := &Context{Storage: map[string]interface{}{csrfKey: secret}}
+	cookie := &http.Cookie{Name: "_csrf", Value: base64.RawURLEncoding.EncodeToString(secret)}
+	recorder := serveCSRF(router, csrfRequest{
+		form:    url.Values{"csrf_token": {context.CSRFToken()}},
+		cookies: []*http.Cookie{cookie},
+	})
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("planted cookie is accepted: %d", recorder.Code)
+	}
+}
+
+func TestCSRFDoubleSubmitNeedsCookieKeys(t *testing.T) {
+	router := NewRouter()
+	router.Use(NewCSRFMiddleware(CSRFConfig{}))
+	router.mainRoute.GET("/", func(context *Context) error {
+		return context.SendString("ok")
+	})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), errCSRFKeys.Error()) {
+		t.Fatalf("expected %q, got %d %s", errCSRFKeys, recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,127 @@
+package magic
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	errBodyTooLarge = errors.New("request body too large")
+)
+
+// DecompressConfig structure
+// MaxSize - max size of decompressed body in bytes (default MaxBytes)
+type DecompressConfig struct {
+	MaxSize int64
+}
+
+// NewDecompressMiddleware function
+// Create new middleware which decodes gzip, deflate and zstd request body by Content-Encoding
+// Use it in magic.Pre, then context.Body, ParseJSON and form params get decoded body
+// Send 413 if decoded body is bigger than MaxSize, 415 if encoding is unsupported
+func NewDecompressMiddleware(config DecompressConfig) Middleware {
+	return NewMiddleware(func(context *Context) error {
+		request := context.Request
+		contentEncoding := strings.TrimSpace(request.Header.Get("Content-Encoding"))
+		if contentEncoding == "" || strings.EqualFold(contentEncoding, "identity") {
+			return nil
+		}
+		maxSize := config.MaxSize
+		if maxSize <= 0 {
+			maxSize = MaxBytes
+		}
+
+		body, err := readLimited(request.Body, maxSize)
+		request.Body.Close()
+		if err != nil {
+			return sendDecompressError(context, err)
+		}
+		encodings := strings.Split(contentEncoding, ",")
+		for i := len(encodings) - 1; i >= 0; i-- {
+			body, err = decodeBody(strings.ToLower(strings.TrimSpace(encodings[i])), body, maxSize)
+			if err != nil {
+				return sendDecompressError(context, err)
+			}
+		}
+
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		request.ContentLength = int64(len(body))
+		request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		request.Header.Del("Content-Encoding")
+		return nil
+	})
+}
+
+func decodeBody(encoding string, body []byte, maxSize int64) ([]byte, error) {
+	switch encoding {
+	case "identity", "":
+		return body, nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readLimited(reader, maxSize)
+	case "deflate":
+		reader, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			// some clients send raw deflate without zlib header
+			reader = flate.NewReader(bytes.NewReader(body))
+		}
+		defer reader.Close()
+		return readLimited(reader, maxSize)
+	case "zstd":
+		reader, err := zstd.NewReader(bytes.NewReader(body),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxSize)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		body, err := readLimited(reader, maxSize)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, errBodyTooLarge
+		}
+		return body, err
+	default:
+		return nil, errEncoding
+	}
+}
+
+// readLimited function
+// Read all from reader, return errBodyTooLarge if there are more than maxSize bytes
+func readLimited(reader io.Reader, maxSize int64) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
+
+func sendDecompressError(context *Context, err error) error {
+	switch err {
+	case errBodyTooLarge:
+		context.Writer.WriteHeader(http.StatusRequestEntityTooLarge)
+	case errEncoding:
+		context.Writer.WriteHeader(http.StatusUnsupportedMediaType)
+	default:
+		context.Writer.WriteHeader(http.StatusBadRequest)
+		err = errors.New("invalid compressed body")
+	}
+	return context.SendError(err)
+}
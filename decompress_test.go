@@ -0,0 +1,111 @@
+package magic
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func compressTestData(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	var writer io.WriteCloser
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(buffer)
+	case "deflate":
+		writer = zlib.NewWriter(buffer)
+	case "raw deflate":
+		writer, _ = flate.NewWriter(buffer, flate.DefaultCompression)
+	case "zstd":
+		writer, _ = zstd.NewWriter(buffer)
+	}
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func newDecompressTestRouter(config DecompressConfig) *Router {
+	router := NewRouter()
+	router.Pre(NewDecompressMiddleware(config))
+	router.mainRoute.POST("/", func(context *Context) error {
+		user := struct {
+			Name string `json:"name"`
+		}{}
+		if err := context.ParseJSON(&user); err != nil {
+			context.Writer.WriteHeader(http.StatusBadRequest)
+			return context.SendError(err)
+		}
+		return context.SendString(user.Name)
+	})
+	return router
+}
+
+func serveDecompress(router *Router, encoding string, body []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Content-Encoding", encoding)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestDecompressMiddleware(t *testing.T) {
+	router := newDecompressTestRouter(DecompressConfig{})
+	body := []byte(`{"name": "magic"}`)
+	cases := map[string]string{
+		"gzip":        "gzip",
+		"deflate":     "deflate",
+		"raw deflate": "deflate",
+		"zstd":        "zstd",
+	}
+	for name, encoding := range cases {
+		recorder := serveDecompress(router, encoding, compressTestData(t, name, body))
+		if recorder.Code != http.StatusOK || recorder.Body.String() != "magic" {
+			t.Fatalf("%s: expected decoded body, got %d %s", name, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	twice := compressTestData(t, "zstd", compressTestData(t, "gzip", body))
+	if recorder := serveDecompress(router, "gzip, zstd", twice); recorder.Body.String() != "magic" {
+		t.Fatalf("expected body decoded twice, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serveDecompress(router, "identity", body); recorder.Body.String() != "magic" {
+		t.Fatalf("identity body is changed: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestDecompressMiddlewareErrors(t *testing.T) {
+	router := newDecompressTestRouter(DecompressConfig{MaxSize: 1024})
+	bomb := []byte(`{"name": "` + strings.Repeat("a", 1<<20) + `"}`)
+	cases := []struct {
+		name     string
+		encoding string
+		body     []byte
+		code     int
+	}{
+		{"gzip bomb", "gzip", compressTestData(t, "gzip", bomb), http.StatusRequestEntityTooLarge},
+		{"deflate bomb", "deflate", compressTestData(t, "deflate", bomb), http.StatusRequestEntityTooLarge},
+		{"zstd bomb", "zstd", compressTestData(t, "zstd", bomb), http.StatusRequestEntityTooLarge},
+		{"large compressed body", "gzip", bytes.Repeat([]byte{0}, 2048), http.StatusRequestEntityTooLarge},
+		{"unknown encoding", "compress", []byte("data"), http.StatusUnsupportedMediaType},
+		{"corrupt gzip", "gzip", []byte("not gzip"), http.StatusBadRequest},
+		{"corrupt zstd", "zstd", []byte("not zstd"), http.StatusBadRequest},
+	}
+	for _, test := range cases {
+		recorder := serveDecompress(router, test.encoding, test.body)
+		if recorder.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d %s", test.name, test.code, recorder.Code, recorder.Body.String())
+		}
+	}
+}
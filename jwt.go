@@ -0,0 +1,361 @@
+package magic
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	errJWTInvalid        = errors.New("miss or invalid JWT")
+	errJWTAlgorithm      = errors.New("JWT signing algorithm is not allowed")
+	errJWTExpired        = errors.New("JWT is expired")
+	errJWTNotValidYet    = errors.New("JWT is not valid yet")
+	errJWTIssuedInFuture = errors.New("JWT is issued in future")
+	errJWTMissingExp     = errors.New("JWT has no exp")
+	errJWTIssuer         = errors.New("JWT has invalid issuer")
+	errJWTAudience       = errors.New("JWT has invalid audience")
+	errJWTSecretKey      = errors.New("JWT middleware needs secret key or key provider")
+)
+
+// ClaimsKey - key of JWT claims in context.Storage, claims are map[string]interface{}
+const ClaimsKey = "claims"
+
+const typedClaimsKey = "magic.typedClaims"
+
+// JWTConfig structure
+// SecretKey - key for HMAC algorithms, used if KeyProvider is nil
+// KeyProvider - provider of keys like NewPEMKeyProvider or NewJWKSKeyProvider
+// HeaderName - header with token like "Authorization" for "Bearer <token>" (default "Authorization")
+// Extractor - function which gets token from request (default JWTFromHeader(HeaderName, "Bearer"))
+// Algorithms - allowed signing algorithms (default ["HS256"] for SecretKey, ["RS256", "ES256", "EdDSA"] for KeyProvider)
+// Leeway - allowed clock skew for exp, nbf and iat
+// AllowMissingExp - accept tokens without exp, by default they are rejected
+// Issuer - required iss if not empty
+// Audience - required aud if not empty
+// NewClaims - return pointer to your claims struct like ClaimsType[MyClaims](), read it by Claims[MyClaims](context)
+// Revocation - store of revoked tokens, tokens with revoked jti or fam are rejected
+type JWTConfig struct {
+	SecretKey       string
+	KeyProvider     JWTKeyProvider
+	HeaderName      string
+	Extractor       JWTExtractor
+	Algorithms      []string
+	Leeway          time.Duration
+	AllowMissingExp bool
+	Issuer          string
+	Audience        string
+	NewClaims       func() interface{}
+	Revocation      RevocationStore
+}
+
+// JWTExtractor type
+// Return token from request or error
+type JWTExtractor func(context *Context) (string, error)
+
+// NewJWTMiddleware function
+// Create new JWT authorization middleware for HS256, HS384 and HS512 tokens with exp
+// Claims will contains in context.Storage["claims"]
+// contex.Storage["claims"] -> map[string]interface{}
+func NewJWTMiddleware(secretKey, headerName string) Middleware {
+	return NewJWTMiddlewareWithConfig(JWTConfig{
+		SecretKey:  secretKey,
+		Extractor:  jwtFromHeaderAnyScheme(headerName),
+		Algorithms: []string{"HS256", "HS384", "HS512"},
+	})
+}
+
+// NewJWTMiddlewareWithConfig function
+// Create new JWT authorization middleware
+// Send 401 if token is missed or invalid
+// Claims will contains in context.Storage[ClaimsKey]
+// Panic if there are no SecretKey and KeyProvider
+func NewJWTMiddlewareWithConfig(config JWTConfig) Middleware {
+	if config.SecretKey == "" && config.KeyProvider == nil {
+		panic(errJWTSecretKey)
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "Authorization"
+	}
+	if config.Extractor == nil {
+		config.Extractor = JWTFromHeader(config.HeaderName, "Bearer")
+	}
+	if len(config.Algorithms) == 0 {
+		if config.KeyProvider == nil {
+			config.Algorithms = []string{"HS256"}
+		} else {
+			config.Algorithms = []string{"RS256", "ES256", "EdDSA"}
+		}
+	}
+	if config.KeyProvider == nil {
+		config.KeyProvider = hmacKeyProvider(config.SecretKey)
+	}
+	return NewMiddleware(func(context *Context) error {
+		tokenStr, err := config.Extractor(context)
+		if err != nil || tokenStr == "" {
+			return sendJWTError(context, errJWTInvalid)
+		}
+
+		claims, err := parseJWT(tokenStr, config)
+		if err == nil && claims["typ"] == TokenTypeRefresh {
+			err = errJWTType
+		}
+		if err == nil {
+			err = checkRevocation(claims, config.Revocation)
+		}
+		if err != nil {
+			return sendJWTError(context, err)
+		}
+		context.Storage[ClaimsKey] = map[string]interface{}(claims)
+
+		if config.NewClaims != nil {
+			typedClaims := config.NewClaims()
+			bytes, err := json.Marshal(claims)
+			if err == nil {
+				err = json.Unmarshal(bytes, typedClaims)
+			}
+			if err != nil {
+				return sendJWTError(context, errJWTInvalid)
+			}
+			context.Storage[typedClaimsKey] = typedClaims
+		}
+		return nil
+	})
+}
+
+// JWTFromHeader function
+// Get token from header like "Authorization: Bearer <token>"
+// Scheme is compared case-insensitive, if scheme is empty all value of header is token
+func JWTFromHeader(headerName, scheme string) JWTExtractor {
+	return func(context *Context) (string, error) {
+		value := strings.TrimSpace(context.Request.Header.Get(headerName))
+		if value == "" {
+			return "", errJWTInvalid
+		}
+		if scheme == "" {
+			return value, nil
+		}
+		if len(value) <= len(scheme) || !strings.EqualFold(value[:len(scheme)], scheme) || value[len(scheme)] != ' ' {
+			return "", errJWTInvalid
+		}
+		return strings.TrimSpace(value[len(scheme)+1:]), nil
+	}
+}
+
+// JWTFromCookie function
+// Get token from cookie
+func JWTFromCookie(name string) JWTExtractor {
+	return func(context *Context) (string, error) {
+		cookie, err := context.Request.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			return "", errJWTInvalid
+		}
+		return cookie.Value, nil
+	}
+}
+
+// JWTFromQuery function
+// Get token from query param like "?token=<token>"
+func JWTFromQuery(name string) JWTExtractor {
+	return func(context *Context) (string, error) {
+		token := context.Request.URL.Query().Get(name)
+		if token == "" {
+			return "", errJWTInvalid
+		}
+		return token, nil
+	}
+}
+
+// JWTFromChain function
+// Get token by first extractor which finds it
+func JWTFromChain(extractors ...JWTExtractor) JWTExtractor {
+	return func(context *Context) (string, error) {
+		for _, extractor := range extractors {
+			token, err := extractor(context)
+			if err == nil && token != "" {
+				return token, nil
+			}
+		}
+		return "", errJWTInvalid
+	}
+}
+
+// jwtFromHeaderAnyScheme function
+// Get token from header like "<any scheme> <token>"
+func jwtFromHeaderAnyScheme(headerName string) JWTExtractor {
+	return func(context *Context) (string, error) {
+		mas := strings.Split(context.Request.Header.Get(headerName), " ")
+		if len(mas) != 2 || mas[1] == "" {
+			return "", errJWTInvalid
+		}
+		return mas[1], nil
+	}
+}
+
+// ClaimsType function
+// Return function for JWTConfig.NewClaims which creates *T
+func ClaimsType[T any]() func() interface{} {
+	return func() interface{} {
+		return new(T)
+	}
+}
+
+// Claims function
+// Return claims decoded to your type by JWTConfig.NewClaims
+// Return false if there are no claims of this type
+func Claims[T any](context *Context) (*T, bool) {
+	claims, ok := context.Storage[typedClaimsKey].(*T)
+	return claims, ok
+}
+
+// parseJWT function
+// Check signature, algorithm and claims of token
+func parseJWT(tokenStr string, config JWTConfig) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{
+		SkipClaimsValidation: true,
+	}
+	claims := jwt.MapClaims{}
+	token, err := parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if !allowedAlgorithm(token.Method.Alg(), config.Algorithms) {
+			return nil, errJWTAlgorithm
+		}
+		key, err := config.KeyProvider.Key(token)
+		if err != nil {
+			return nil, err
+		}
+		return key, checkJWTKey(token.Method, key)
+	})
+	if err != nil {
+		if validationErr, ok := err.(*jwt.ValidationError); ok {
+			switch validationErr.Inner {
+			case errJWTAlgorithm, errJWTKey, errJWTKeyType:
+				return nil, validationErr.Inner
+			}
+		}
+		return nil, errJWTInvalid
+	}
+	if !token.Valid {
+		return nil, errJWTInvalid
+	}
+	return claims, validateJWTClaims(claims, config, time.Now())
+}
+
+func allowedAlgorithm(algorithm string, algorithms []string) bool {
+	for _, allowed := range algorithms {
+		if algorithm == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// validateJWTClaims function
+// Check exp, nbf, iat (RFC 7519, numeric dates in seconds), iss and aud
+// Dates greater than maxNumericDate are read as nanoseconds of old GenerateJWTToken
+func validateJWTClaims(claims jwt.MapClaims, config JWTConfig, now time.Time) error {
+	leeway := config.Leeway.Seconds()
+	nowSeconds := float64(now.UnixNano()) / float64(time.Second)
+
+	exp, ok, err := numericDateClaim(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok && !config.AllowMissingExp {
+		return errJWTMissingExp
+	}
+	if ok && nowSeconds >= exp+leeway {
+		return errJWTExpired
+	}
+
+	nbf, ok, err := numericDateClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && nowSeconds+leeway < nbf {
+		return errJWTNotValidYet
+	}
+
+	iat, ok, err := numericDateClaim(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if ok && nowSeconds+leeway < iat {
+		return errJWTIssuedInFuture
+	}
+
+	if config.Issuer != "" {
+		iss, _ := claims["iss"].(string)
+		if iss != config.Issuer {
+			return errJWTIssuer
+		}
+	}
+
+	if config.Audience != "" && !audienceContains(claims["aud"], config.Audience) {
+		return errJWTAudience
+	}
+	return nil
+}
+
+// maxNumericDate - dates in seconds are less than it for next 30000 years
+const maxNumericDate = 1e12
+
+func numericDateClaim(claims jwt.MapClaims, name string) (float64, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return 0, false, nil
+	}
+	number, ok := value.(float64)
+	if !ok {
+		return 0, false, errJWTInvalid
+	}
+	if number > maxNumericDate {
+		number /= float64(time.Second)
+	}
+	return number, true, nil
+}
+
+func audienceContains(aud interface{}, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, item := range value {
+			if str, ok := item.(string); ok && str == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sendJWTError(context *Context, err error) error {
+	context.Writer.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	context.Writer.WriteHeader(http.StatusUnauthorized)
+	return context.SendError(err)
+}
+
+// GenerateJWTToken function
+// Use your claims, your method, secretKey and time
+// Generate token with exp and iat in seconds and return it
+func GenerateJWTToken(claims map[string]interface{}, method *jwt.SigningMethodHMAC, secretKey string, duration time.Duration) (string, error) {
+	return GenerateJWTTokenWithKey(claims, method, []byte(secretKey), "", duration)
+}
+
+// GenerateJWTTokenWithKey function
+// Use your claims, any method, private key (or []byte for HMAC), kid and time
+// Kid is not set if it is empty
+// Generate token with exp and iat in seconds and return it
+func GenerateJWTTokenWithKey(claims map[string]interface{}, method jwt.SigningMethod, key interface{}, keyID string, duration time.Duration) (string, error) {
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
+	token := jwt.NewWithClaims(method, jwt.MapClaims(claims))
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+	return token.SignedString(key)
+}
@@ -0,0 +1,335 @@
+package magic
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const testJWTSecret = "secret"
+
+func signTestJWT(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// serveJWT function
+// Send request with "Authorization: Bearer <token>" through middleware and return response
+func serveJWT(middleware Middleware, token string) *httptest.ResponseRecorder {
+	router := NewRouter()
+	router.mainRoute.GET("/", func(context *Context) error {
+		return context.SendString("protected")
+	}, middleware)
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestJWTMiddlewareRejections(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	rsaProvider, err := NewPEMKeyProvider(map[string][]byte{"": publicPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": "user",
+			"iat": now.Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+			"iss": "magic",
+			"aud": "api",
+		}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	hs256 := func(claims jwt.MapClaims) string {
+		return signTestJWT(t, jwt.SigningMethodHS256, []byte(testJWTSecret), claims)
+	}
+	secretConfig := JWTConfig{SecretKey: testJWTSecret}
+
+	cases := []struct {
+		name   string
+		config JWTConfig
+		token  string
+		err    error
+	}{
+		{
+			name:   "algorithm not allowed",
+			config: secretConfig,
+			token:  signTestJWT(t, jwt.SigningMethodHS384, []byte(testJWTSecret), valid()),
+			err:    errJWTAlgorithm,
+		},
+		{
+			name:   "alg none",
+			config: JWTConfig{SecretKey: testJWTSecret, Algorithms: []string{"HS256", "none"}},
+			token:  signTestJWT(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid()),
+			err:    errJWTKeyType,
+		},
+		{
+			name:   "HS256 signed with RSA public key",
+			config: JWTConfig{KeyProvider: rsaProvider, Algorithms: []string{"RS256", "HS256"}},
+			token:  signTestJWT(t, jwt.SigningMethodHS256, publicPEM, valid()),
+			err:    errJWTKeyType,
+		},
+		{
+			name:   "empty HMAC key",
+			config: JWTConfig{KeyProvider: hmacKeyProvider(""), Algorithms: []string{"HS256"}},
+			token:  signTestJWT(t, jwt.SigningMethodHS256, []byte(""), valid()),
+			err:    errJWTKeyType,
+		},
+		{
+			name:   "expired",
+			config: secretConfig,
+			token:  hs256(with("exp", now.Add(-10*time.Second).Unix())),
+			err:    errJWTExpired,
+		},
+		{
+			name:   "expired out of leeway",
+			config: JWTConfig{SecretKey: testJWTSecret, Leeway: 5 * time.Second},
+			token:  hs256(with("exp", now.Add(-10*time.Second).Unix())),
+			err:    errJWTExpired,
+		},
+		{
+			name:   "expired in leeway",
+			config: JWTConfig{SecretKey: testJWTSecret, Leeway: time.Minute},
+			token:  hs256(with("exp", now.Add(-10*time.Second).Unix())),
+		},
+		{
+			name:   "expired in nanoseconds",
+			config: secretConfig,
+			token:  hs256(with("exp", now.Add(-time.Hour).UnixNano())),
+			err:    errJWTExpired,
+		},
+		{
+			name:   "valid in nanoseconds",
+			config: secretConfig,
+			token:  hs256(with("exp", now.Add(time.Hour).UnixNano())),
+		},
+		{
+			name:   "nbf in future",
+			config: secretConfig,
+			token:  hs256(with("nbf", now.Add(time.Hour).Unix())),
+			err:    errJWTNotValidYet,
+		},
+		{
+			name:   "iat in future",
+			config: secretConfig,
+			token:  hs256(with("iat", now.Add(time.Hour).Unix())),
+			err:    errJWTIssuedInFuture,
+		},
+		{
+			name:   "missing exp",
+			config: secretConfig,
+			token:  hs256(with("exp", nil)),
+			err:    errJWTMissingExp,
+		},
+		{
+			name:   "missing exp is allowed",
+			config: JWTConfig{SecretKey: testJWTSecret, AllowMissingExp: true},
+			token:  hs256(with("exp", nil)),
+		},
+		{
+			name:   "wrong issuer",
+			config: JWTConfig{SecretKey: testJWTSecret, Issuer: "other"},
+			token:  hs256(valid()),
+			err:    errJWTIssuer,
+		},
+		{
+			name:   "wrong audience",
+			config: JWTConfig{SecretKey: testJWTSecret, Audience: "other"},
+			token:  hs256(valid()),
+			err:    errJWTAudience,
+		},
+		{
+			name:   "audience in list",
+			config: JWTConfig{SecretKey: testJWTSecret, Audience: "api"},
+			token:  hs256(with("aud", []string{"web", "api"})),
+		},
+		{
+			name:   "non-numeric exp",
+			config: secretConfig,
+			token:  hs256(with("exp", "tomorrow")),
+			err:    errJWTInvalid,
+		},
+		{
+			name:   "bad signature",
+			config: JWTConfig{SecretKey: "other"},
+			token:  hs256(valid()),
+			err:    errJWTInvalid,
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serveJWT(NewJWTMiddlewareWithConfig(test.config), test.token)
+			if test.err == nil {
+				if recorder.Code != http.StatusOK || recorder.Body.String() != "protected" {
+					t.Fatalf("expected 200, got %d %s", recorder.Code, recorder.Body.String())
+				}
+				return
+			}
+			if recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("expected 401, got %d", recorder.Code)
+			}
+			if !strings.Contains(recorder.Body.String(), test.err.Error()) {
+				t.Fatalf("expected %q, got %s", test.err, recorder.Body.String())
+			}
+			if recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("WWW-Authenticate is missed")
+			}
+		})
+	}
+}
+
+func TestNewJWTMiddlewareNanosecondExp(t *testing.T) {
+	claims := jwt.MapClaims{"exp": time.Now().Add(-time.Hour).UnixNano()}
+	recorder := serveJWT(NewJWTMiddleware("k", "Authorization"), signTestJWT(t, jwt.SigningMethodHS256, []byte("k"), claims))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", recorder.Code)
+	}
+}
+
+func TestJWTMiddlewareWithoutKeyPanics(t *testing.T) {
+	defer func() {
+		if recover() != errJWTSecretKey {
+			t.Fatal("expected panic on config without key")
+		}
+	}()
+	NewJWTMiddlewareWithConfig(JWTConfig{})
+}
+
+func TestJWTFromHeader(t *testing.T) {
+	cases := []struct {
+		scheme string
+		value  string
+		token  string
+	}{
+		{"Bearer", "Bearer abc", "abc"},
+		{"Bearer", "bearer abc", "abc"},
+		{"Bearer", "BEARER  abc ", "abc"},
+		{"Bearer", "abc", ""},
+		{"Bearer", "Basic abc", ""},
+		{"Bearer", "Bearerabc", ""},
+		{"Bearer", "Bearer ", ""},
+		{"Bearer", "", ""},
+		{"", "abc", "abc"},
+	}
+	for _, test := range cases {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Authorization", test.value)
+		token, err := JWTFromHeader("Authorization", test.scheme)(&Context{Request: request})
+		if token != test.token || (test.token == "") != (err == errJWTInvalid) {
+			t.Fatalf("%q %q: expected %q, got %q %v", test.scheme, test.value, test.token, token, err)
+		}
+	}
+}
+
+func TestJWTFromChain(t *testing.T) {
+	token := signTestJWT(t, jwt.SigningMethodHS256, []byte(testJWTSecret), jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+	router := NewRouter()
+	router.mainRoute.GET("/", func(context *Context) error {
+		return context.SendString("protected")
+	}, NewJWTMiddlewareWithConfig(JWTConfig{
+		SecretKey: testJWTSecret,
+		Extractor: JWTFromChain(JWTFromHeader("Authorization", "Bearer"), JWTFromCookie("jwt"), JWTFromQuery("token")),
+	}))
+	cases := []struct {
+		name   string
+		header string
+		cookie string
+		query  string
+		code   int
+	}{
+		{"header", "Bearer " + token, "", "", http.StatusOK},
+		{"cookie", "", token, "", http.StatusOK},
+		{"query", "", "", "?token=" + token, http.StatusOK},
+		{"header with other scheme", "Basic abc", "", "?token=" + token, http.StatusOK},
+		{"invalid header before cookie", "Bearer invalid", token, "", http.StatusUnauthorized},
+		{"nothing", "", "", "", http.StatusUnauthorized},
+	}
+	for _, test := range cases {
+		request := httptest.NewRequest("GET", "/"+test.query, nil)
+		if test.header != "" {
+			request.Header.Set("Authorization", test.header)
+		}
+		if test.cookie != "" {
+			request.AddCookie(&http.Cookie{Name: "jwt", Value: test.cookie})
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.name, test.code, recorder.Code)
+		}
+	}
+}
+
+type testUserClaims struct {
+	Subject string   `json:"sub"`
+	Roles   []string `json:"roles"`
+}
+
+func TestTypedClaims(t *testing.T) {
+	middleware := NewJWTMiddlewareWithConfig(JWTConfig{
+		SecretKey: testJWTSecret,
+		NewClaims: ClaimsType[testUserClaims](),
+	})
+	router := NewRouter()
+	router.mainRoute.GET("/", func(context *Context) error {
+		claims, ok := Claims[testUserClaims](context)
+		if !ok {
+			return context.SendString("no claims")
+		}
+		if _, ok := Claims[SpanData](context); ok {
+			return context.SendString("claims of other type")
+		}
+		return context.SendString(claims.Subject + ":" + strings.Join(claims.Roles, ","))
+	}, middleware)
+	serve := func(claims jwt.MapClaims) *httptest.ResponseRecorder {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Authorization", "Bearer "+signTestJWT(t, jwt.SigningMethodHS256, []byte(testJWTSecret), claims))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if body := serve(jwt.MapClaims{"sub": "bob", "roles": []string{"admin", "editor"}}).Body.String(); body != "bob:admin,editor" {
+		t.Fatalf("wrong typed claims %q", body)
+	}
+	if recorder := serve(jwt.MapClaims{"sub": 42}); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("claims of wrong type are accepted: %d", recorder.Code)
+	}
+	if _, ok := Claims[testUserClaims](&Context{Storage: map[string]interface{}{}}); ok {
+		t.Fatal("claims are found without middleware")
+	}
+}
@@ -0,0 +1,430 @@
+package magic
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	errJWTKey      = errors.New("JWT key not found")
+	errJWTKeyType  = errors.New("JWT key doesn't match signing algorithm")
+	errPEM         = errors.New("invalid PEM public key")
+	errJWKS        = errors.New("invalid JWKS")
+	errJWKSSource  = errors.New("JWKS must have URL or File")
+	errEdDSAKey    = errors.New("invalid EdDSA key")
+	errEdDSAVerify = errors.New("EdDSA signature is invalid")
+)
+
+// SigningMethodEdDSA - Ed25519 signing method for JWT, alg "EdDSA"
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEdDSA struct{}
+
+func (method *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (method *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok || len(publicKey) != ed25519.PublicKeySize {
+		return errEdDSAKey
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return errEdDSAVerify
+	}
+	return nil
+}
+
+func (method *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok || len(privateKey) != ed25519.PrivateKeySize {
+		return "", errEdDSAKey
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+// JWTKeyProvider interface
+// Return key for verification of token, token.Header["kid"] can be used to choose key
+type JWTKeyProvider interface {
+	Key(token *jwt.Token) (interface{}, error)
+}
+
+type hmacKeyProvider []byte
+
+func (key hmacKeyProvider) Key(token *jwt.Token) (interface{}, error) {
+	return []byte(key), nil
+}
+
+// checkJWTKey function
+// Check that type of key matches signing method, it prevents algorithm confusion
+// Empty HMAC key is rejected
+func checkJWTKey(method jwt.SigningMethod, key interface{}) error {
+	ok := false
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		var bytes []byte
+		bytes, ok = key.([]byte)
+		ok = ok && len(bytes) != 0
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = key.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		_, ok = key.(*ecdsa.PublicKey)
+	case *signingMethodEdDSA:
+		_, ok = key.(ed25519.PublicKey)
+	}
+	if !ok {
+		return errJWTKeyType
+	}
+	return nil
+}
+
+func tokenKeyID(token *jwt.Token) string {
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+// PEMKeyProvider structure
+// JWTKeyProvider with PEM public keys by kid
+type PEMKeyProvider struct {
+	keys map[string]interface{}
+}
+
+// NewPEMKeyProvider function
+// Create JWTKeyProvider from PEM public keys (RSA, ECDSA or Ed25519) by kid
+// Key with kid "" is used for tokens without kid
+// Keys can't be changed later, to rotate keys create new provider and middleware with old and new kid,
+// remove old kid when its tokens are expired
+func NewPEMKeyProvider(keys map[string][]byte) (*PEMKeyProvider, error) {
+	provider := &PEMKeyProvider{
+		keys: make(map[string]interface{}),
+	}
+	for kid, pemBytes := range keys {
+		key, err := ParsePEMPublicKey(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%v: kid %q", err, kid)
+		}
+		provider.keys[kid] = key
+	}
+	return provider, nil
+}
+
+// Key function
+// Return key by kid of token
+func (provider *PEMKeyProvider) Key(token *jwt.Token) (interface{}, error) {
+	key, ok := provider.keys[tokenKeyID(token)]
+	if !ok {
+		return nil, errJWTKey
+	}
+	return key, nil
+}
+
+// ParsePEMPublicKey function
+// Parse PEM "PUBLIC KEY", "RSA PUBLIC KEY" or "CERTIFICATE"
+func ParsePEMPublicKey(pemBytes []byte) (interface{}, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errPEM
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var certificate *x509.Certificate
+		certificate, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = certificate.PublicKey
+		}
+	default:
+		return nil, errPEM
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, errPEM
+}
+
+// JWKSConfig structure
+// URL - url of JWKS document like "https://auth.example.com/.well-known/jwks.json"
+// File - path of JWKS file, used if URL is empty
+// CacheTTL - time while keys are cached (default 10 minutes)
+// MinRefreshInterval - min time between refreshes for unknown kid or after failed refresh (default 1 minute)
+// HTTPClient - client for URL (default client with 10 seconds timeout)
+type JWKSConfig struct {
+	URL                string
+	File               string
+	CacheTTL           time.Duration
+	MinRefreshInterval time.Duration
+	HTTPClient         *http.Client
+}
+
+// maxJWKSSize - max size of JWKS document
+const maxJWKSSize = 1 << 20
+
+// JWKSKeyProvider structure
+// JWTKeyProvider with keys from JWKS document
+// Keys are refreshed after CacheTTL or when token has unknown kid, but not often than MinRefreshInterval
+// Old keys are used while refresh fails
+type JWKSKeyProvider struct {
+	config      JWKSConfig
+	mutex       sync.RWMutex
+	refreshLock sync.Mutex
+	keys        map[string]jwksKey
+	fetched     time.Time
+	attempted   time.Time
+	refreshErr  error
+}
+
+type jwksKey struct {
+	key       interface{}
+	algorithm string
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWKSKeyProvider function
+// Create JWTKeyProvider from JWKS, keys are loaded on first token
+func NewJWKSKeyProvider(config JWKSConfig) *JWKSKeyProvider {
+	if config.URL == "" && config.File == "" {
+		panic(errJWKSSource)
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = 10 * time.Minute
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = time.Minute
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKSKeyProvider{
+		config: config,
+	}
+}
+
+// Key function
+// Return key by kid of token, refresh keys if kid is unknown
+func (provider *JWKSKeyProvider) Key(token *jwt.Token) (interface{}, error) {
+	kid := tokenKeyID(token)
+	key, ok, fresh := provider.lookup(kid)
+	if (!fresh || !ok) && provider.canRefresh() {
+		if err := provider.refresh(time.Now()); err != nil && !ok {
+			return nil, err
+		}
+		key, ok, _ = provider.lookup(kid)
+	}
+	if !ok {
+		return nil, errJWTKey
+	}
+	if key.algorithm != "" && key.algorithm != token.Method.Alg() {
+		return nil, errJWTKeyType
+	}
+	return key.key, nil
+}
+
+// Refresh function
+// Load keys from URL or File
+// Concurrent calls share one load, old keys are kept if it fails
+func (provider *JWKSKeyProvider) Refresh() error {
+	return provider.refresh(time.Now())
+}
+
+// refresh function
+// Load keys if there was no attempt after requested time
+func (provider *JWKSKeyProvider) refresh(requested time.Time) error {
+	provider.refreshLock.Lock()
+	defer provider.refreshLock.Unlock()
+
+	provider.mutex.RLock()
+	attempted, refreshErr := provider.attempted, provider.refreshErr
+	provider.mutex.RUnlock()
+	if attempted.After(requested) {
+		return refreshErr
+	}
+
+	keys, err := provider.load()
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	provider.attempted = time.Now()
+	provider.refreshErr = err
+	if err != nil {
+		return err
+	}
+	provider.keys = keys
+	provider.fetched = provider.attempted
+	return nil
+}
+
+func (provider *JWKSKeyProvider) load() (map[string]jwksKey, error) {
+	var body []byte
+	var err error
+	if provider.config.URL != "" {
+		body, err = provider.fetch()
+	} else {
+		body, err = ioutil.ReadFile(provider.config.File)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(body)
+}
+
+func (provider *JWKSKeyProvider) lookup(kid string) (jwksKey, bool, bool) {
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+	fresh := provider.keys != nil && time.Since(provider.fetched) < provider.config.CacheTTL
+	key, ok := provider.keys[kid]
+	if !ok && kid == "" && len(provider.keys) == 1 {
+		for _, onlyKey := range provider.keys {
+			key, ok = onlyKey, true
+		}
+	}
+	return key, ok, fresh
+}
+
+func (provider *JWKSKeyProvider) canRefresh() bool {
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+	return time.Since(provider.attempted) >= provider.config.MinRefreshInterval
+}
+
+func (provider *JWKSKeyProvider) fetch() ([]byte, error) {
+	response, err := provider.config.HTTPClient.Get(provider.config.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: status %d", errJWKS, response.StatusCode)
+	}
+	body, err := readLimited(response.Body, maxJWKSSize)
+	if err == errBodyTooLarge {
+		return nil, fmt.Errorf("%v: larger than %d bytes", errJWKS, maxJWKSSize)
+	}
+	return body, err
+}
+
+// parseJWKS function
+// Parse JWKS document, keys with "use" other than "sig" and unsupported keys are skipped
+func parseJWKS(body []byte) (map[string]jwksKey, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+	if document.Keys == nil {
+		return nil, errJWKS
+	}
+	keys := make(map[string]jwksKey)
+	for _, webKey := range document.Keys {
+		if webKey.Use != "" && webKey.Use != "sig" {
+			continue
+		}
+		key, err := webKey.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[webKey.Kid] = jwksKey{key: key, algorithm: webKey.Alg}
+	}
+	return keys, nil
+}
+
+func (webKey jsonWebKey) publicKey() (interface{}, error) {
+	switch webKey.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(webKey.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(webKey.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31 {
+			return nil, errJWKS
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch webKey.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errJWKS
+		}
+		x, err := decodeJWKInt(webKey.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(webKey.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errJWKS
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if webKey.Crv != "Ed25519" {
+			return nil, errJWKS
+		}
+		x, err := base64.RawURLEncoding.DecodeString(webKey.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errJWKS
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errJWKS
+}
+
+func decodeJWKInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(bytes) == 0 {
+		return nil, errJWKS
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -0,0 +1,262 @@
+package magic
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+type testJWKSServer struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	keys    []map[string]string
+	status  int
+	delay   time.Duration
+	fetches int32
+}
+
+func newTestJWKSServer(keys ...map[string]string) *testJWKSServer {
+	server := &testJWKSServer{keys: keys, status: http.StatusOK}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&server.fetches, 1)
+		server.mutex.Lock()
+		status, keys, delay := server.status, server.keys, server.delay
+		server.mutex.Unlock()
+		time.Sleep(delay)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	return server
+}
+
+func (server *testJWKSServer) set(status int, keys ...map[string]string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.status = status
+	if keys != nil {
+		server.keys = keys
+	}
+}
+
+func (server *testJWKSServer) fetchCount() int {
+	return int(atomic.LoadInt32(&server.fetches))
+}
+
+func encodeJWKInt(value *big.Int, size int) string {
+	return base64.RawURLEncoding.EncodeToString(value.FillBytes(make([]byte, size)))
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   encodeJWKInt(key.X, 32),
+		"y":   encodeJWKInt(key.Y, 32),
+	}
+}
+
+func edJWK(kid string, key ed25519.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "OKP",
+		"kid": kid,
+		"crv": "Ed25519",
+		"x":   base64.RawURLEncoding.EncodeToString(key),
+	}
+}
+
+func signTestJWTWithKid(t *testing.T, method jwt.SigningMethod, key interface{}, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "user", "exp": time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+type testJWTKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestJWTKeys(t *testing.T) testJWTKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testJWTKeys{rsa: rsaKey, ec: ecKey, ed: edKey}
+}
+
+func TestJWKSKeyProviderVerification(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	server := newTestJWKSServer(
+		rsaJWK("rsa", &keys.rsa.PublicKey),
+		ecJWK("ec", &keys.ec.PublicKey),
+		edJWK("ed", keys.ed.Public().(ed25519.PublicKey)),
+	)
+	defer server.Close()
+	middleware := NewJWTMiddlewareWithConfig(JWTConfig{
+		KeyProvider: NewJWKSKeyProvider(JWKSConfig{URL: server.URL}),
+		Algorithms:  []string{"RS256", "ES256", "EdDSA", "HS256"},
+	})
+
+	cases := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"RS256", signTestJWTWithKid(t, jwt.SigningMethodRS256, keys.rsa, "rsa"), http.StatusOK},
+		{"ES256", signTestJWTWithKid(t, jwt.SigningMethodES256, keys.ec, "ec"), http.StatusOK},
+		{"EdDSA", signTestJWTWithKid(t, SigningMethodEdDSA, keys.ed, "ed"), http.StatusOK},
+		{"kid of other key", signTestJWTWithKid(t, jwt.SigningMethodRS256, keys.rsa, "ec"), http.StatusUnauthorized},
+		{"unknown kid", signTestJWTWithKid(t, jwt.SigningMethodRS256, keys.rsa, "other"), http.StatusUnauthorized},
+		{"RSA key with HS256", signTestJWTWithKid(t, jwt.SigningMethodHS256, keys.rsa.PublicKey.N.Bytes(), "rsa"), http.StatusUnauthorized},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serveJWT(middleware, test.token)
+			if recorder.Code != test.code {
+				t.Fatalf("expected %d, got %d %s", test.code, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+	recorder := serveJWT(middleware, signTestJWTWithKid(t, jwt.SigningMethodHS256, keys.rsa.PublicKey.N.Bytes(), "rsa"))
+	if !strings.Contains(recorder.Body.String(), errJWTKeyType.Error()) {
+		t.Fatalf("expected %q, got %s", errJWTKeyType, recorder.Body.String())
+	}
+}
+
+func TestJWKSKeyProviderRotation(t *testing.T) {
+	oldKeys := newTestJWTKeys(t)
+	newKeys := newTestJWTKeys(t)
+	server := newTestJWKSServer(rsaJWK("old", &oldKeys.rsa.PublicKey))
+	defer server.Close()
+	middleware := NewJWTMiddlewareWithConfig(JWTConfig{
+		KeyProvider: NewJWKSKeyProvider(JWKSConfig{URL: server.URL, MinRefreshInterval: time.Nanosecond}),
+	})
+
+	if recorder := serveJWT(middleware, signTestJWTWithKid(t, jwt.SigningMethodRS256, oldKeys.rsa, "old")); recorder.Code != http.StatusOK {
+		t.Fatalf("old key: expected 200, got %d", recorder.Code)
+	}
+	server.set(http.StatusOK, rsaJWK("old", &oldKeys.rsa.PublicKey), rsaJWK("new", &newKeys.rsa.PublicKey))
+	if recorder := serveJWT(middleware, signTestJWTWithKid(t, jwt.SigningMethodRS256, newKeys.rsa, "new")); recorder.Code != http.StatusOK {
+		t.Fatalf("new key: expected 200, got %d", recorder.Code)
+	}
+	if fetches := server.fetchCount(); fetches != 2 {
+		t.Fatalf("expected 2 fetches, got %d", fetches)
+	}
+}
+
+func TestJWKSKeyProviderFailingEndpoint(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	server := newTestJWKSServer(rsaJWK("rsa", &keys.rsa.PublicKey))
+	defer server.Close()
+	middleware := NewJWTMiddlewareWithConfig(JWTConfig{
+		KeyProvider: NewJWKSKeyProvider(JWKSConfig{URL: server.URL, CacheTTL: time.Nanosecond, MinRefreshInterval: time.Hour}),
+	})
+	token := signTestJWTWithKid(t, jwt.SigningMethodRS256, keys.rsa, "rsa")
+	if recorder := serveJWT(middleware, token); recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+
+	server.set(http.StatusInternalServerError)
+	for i := 0; i < 20; i++ {
+		if recorder := serveJWT(middleware, token); recorder.Code != http.StatusOK {
+			t.Fatalf("stale key: expected 200, got %d", recorder.Code)
+		}
+		serveJWT(middleware, signTestJWTWithKid(t, jwt.SigningMethodRS256, keys.rsa, "kid"+strconv.Itoa(i)))
+	}
+	if fetches := server.fetchCount(); fetches != 1 {
+		t.Fatalf("expected 1 fetch, got %d", fetches)
+	}
+}
+
+func TestJWKSKeyProviderFailedRefreshIsThrottled(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	server := newTestJWKSServer()
+	server.set(http.StatusInternalServerError)
+	defer server.Close()
+	middleware := NewJWTMiddlewareWithConfig(JWTConfig{
+		KeyProvider: NewJWKSKeyProvider(JWKSConfig{URL: server.URL}),
+	})
+	token := signTestJWTWithKid(t, jwt.SigningMethodRS256, keys.rsa, "rsa")
+	for i := 0; i < 20; i++ {
+		if recorder := serveJWT(middleware, token); recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", recorder.Code)
+		}
+	}
+	if fetches := server.fetchCount(); fetches != 1 {
+		t.Fatalf("expected 1 fetch, got %d", fetches)
+	}
+}
+
+func TestJWKSKeyProviderConcurrentRefresh(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	server := newTestJWKSServer(rsaJWK("rsa", &keys.rsa.PublicKey))
+	server.delay = 50 * time.Millisecond
+	defer server.Close()
+	provider := NewJWKSKeyProvider(JWKSConfig{URL: server.URL})
+	token, _ := jwt.Parse(signTestJWTWithKid(t, jwt.SigningMethodRS256, keys.rsa, "rsa"), nil)
+
+	wait := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if _, err := provider.Key(token); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wait.Wait()
+	if fetches := server.fetchCount(); fetches != 1 {
+		t.Fatalf("expected 1 fetch, got %d", fetches)
+	}
+}
+
+func TestJWKSKeyProviderLimitsBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[],"padding":"` + strings.Repeat("a", maxJWKSSize) + `"}`))
+	}))
+	defer server.Close()
+	err := NewJWKSKeyProvider(JWKSConfig{URL: server.URL}).Refresh()
+	if err == nil || !strings.Contains(err.Error(), errJWKS.Error()) {
+		t.Fatalf("expected %q, got %v", errJWKS, err)
+	}
+}
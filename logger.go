@@ -0,0 +1,183 @@
+package magic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Log formats
+const (
+	LogFormatCommon   = "common"
+	LogFormatCombined = "combined"
+	LogFormatJSON     = "json"
+)
+
+// LoggerConfig structure
+// Format - LogFormatCommon, LogFormatCombined or LogFormatJSON (default LogFormatCombined)
+// Output - writer for logs (default os.Stdout)
+// Handler - slog handler, if set Format and Output are not used
+// SampleRate - part of requests to log from 0 to 1 (0 means all), responses with status >= 500 are always logged
+// SkipPaths - paths or route patterns which are not logged like "/health"
+// Query string is not logged, it can contain tokens and API keys
+type LoggerConfig struct {
+	Format     string
+	Output     io.Writer
+	Handler    slog.Handler
+	SampleRate float64
+	SkipPaths  []string
+}
+
+type accessLog struct {
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Route     string  `json:"route"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	LatencyMs float64 `json:"latency_ms"`
+	IP        string  `json:"ip"`
+	UserAgent string  `json:"user_agent"`
+	RequestID string  `json:"request_id,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// NewLoggerMiddleware function
+// Create new access log middleware
+// Use it in magic.Use to log also not found requests
+func NewLoggerMiddleware(config LoggerConfig) Middleware {
+	if config.Format == "" {
+		config.Format = LogFormatCombined
+	}
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+	skipPaths := make(map[string]bool)
+	for _, path := range config.SkipPaths {
+		skipPaths[path] = true
+	}
+	var logger *slog.Logger
+	if config.Handler != nil {
+		logger = slog.New(config.Handler)
+	}
+	mutex := &sync.Mutex{}
+
+	return NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) error {
+			start := time.Now()
+			err := next(context)
+
+			if skipPaths[context.Request.URL.Path] || skipPaths[context.Route.FullPath()] {
+				return err
+			}
+			status := context.Response.Status()
+			if config.SampleRate > 0 && config.SampleRate < 1 && status < 500 && rand.Float64() >= config.SampleRate {
+				return err
+			}
+
+			entry := accessLog{
+				Time:      start.Format(time.RFC3339),
+				Method:    context.Request.Method,
+				Path:      context.Request.URL.EscapedPath(),
+				Route:     context.Route.FullPath(),
+				Status:    status,
+				Bytes:     context.Response.Size(),
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				IP:        context.RealIP(),
+				UserAgent: context.Request.UserAgent(),
+				RequestID: requestIDForLog(context),
+			}
+			if err != nil {
+				entry.Error = err.Error()
+			}
+
+			if logger != nil {
+				logToSlog(context, logger, entry)
+				return err
+			}
+
+			var line string
+			switch config.Format {
+			case LogFormatJSON:
+				bytes, _ := json.Marshal(entry)
+				line = string(bytes)
+			case LogFormatCommon:
+				line = commonLogLine(context, start, entry)
+			default:
+				line = commonLogLine(context, start, entry) + " " + quoteLogField(context.Request.Referer()) + " " + quoteLogField(entry.UserAgent)
+			}
+			mutex.Lock()
+			fmt.Fprintln(config.Output, line)
+			mutex.Unlock()
+			return err
+		}
+	})
+}
+
+func requestIDForLog(context *Context) string {
+	if context.RequestID != "" {
+		return context.RequestID
+	}
+	if id := context.Response.Header().Get("X-Request-ID"); id != "" {
+		return id
+	}
+	return context.Request.Header.Get("X-Request-ID")
+}
+
+func commonLogLine(context *Context, start time.Time, entry accessLog) string {
+	user := "-"
+	if context.Request.URL.User != nil && context.Request.URL.User.Username() != "" {
+		user = context.Request.URL.User.Username()
+	} else if name, _, ok := context.Request.BasicAuth(); ok && name != "" {
+		user = name
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d",
+		entry.IP,
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method,
+		entry.Path,
+		context.Request.Proto,
+		entry.Status,
+		entry.Bytes,
+	)
+}
+
+func quoteLogField(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
+
+func logToSlog(context *Context, logger *slog.Logger, entry accessLog) {
+	level := slog.LevelInfo
+	if entry.Status >= 500 {
+		level = slog.LevelError
+	} else if entry.Status >= 400 {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("method", entry.Method),
+		slog.String("path", entry.Path),
+		slog.String("route", entry.Route),
+		slog.Int("status", entry.Status),
+		slog.Int64("bytes", entry.Bytes),
+		slog.Float64("latency_ms", entry.LatencyMs),
+		slog.String("ip", entry.IP),
+		slog.String("user_agent", entry.UserAgent),
+	}
+	if entry.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", entry.RequestID))
+	}
+	if entry.Error != "" {
+		attrs = append(attrs, slog.String("error", entry.Error))
+	}
+	logger.LogAttrs(context.Request.Context(), level, "request", attrs...)
+}
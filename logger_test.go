@@ -0,0 +1,113 @@
+package magic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var errLoggerTest = errors.New("database is down")
+
+func newLoggerTestRouter(config LoggerConfig) *Router {
+	router := NewRouter()
+	router.Use(NewLoggerMiddleware(config))
+	router.mainRoute.GET("/users/:id", func(context *Context) error {
+		return context.SendString("user")
+	})
+	router.mainRoute.GET("/health", func(context *Context) error {
+		return context.SendString("ok")
+	})
+	router.mainRoute.GET("/fail", func(context *Context) error {
+		context.Writer.WriteHeader(http.StatusInternalServerError)
+		context.SendErrorString("failed")
+		return errLoggerTest
+	})
+	return router
+}
+
+func serveLogger(router *Router, path string) {
+	request := httptest.NewRequest("GET", path, nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Set("User-Agent", "test-agent")
+	request.Header.Set("Referer", "http://example.com/")
+	request.SetBasicAuth("bob", "password")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+}
+
+func TestLoggerFormats(t *testing.T) {
+	cases := map[string]*regexp.Regexp{
+		LogFormatCommon:   regexp.MustCompile(`^10\.0\.0\.1 - bob \[[^\]]+\] "GET /users/42 HTTP/1\.1" 200 4\n$`),
+		LogFormatCombined: regexp.MustCompile(`^10\.0\.0\.1 - bob \[[^\]]+\] "GET /users/42 HTTP/1\.1" 200 4 "http://example\.com/" "test-agent"\n$`),
+	}
+	for format, pattern := range cases {
+		output := &bytes.Buffer{}
+		serveLogger(newLoggerTestRouter(LoggerConfig{Format: format, Output: output}), "/users/42?access_token=secret")
+		if !pattern.MatchString(output.String()) {
+			t.Fatalf("%s: wrong line %q", format, output.String())
+		}
+	}
+
+	output := &bytes.Buffer{}
+	serveLogger(newLoggerTestRouter(LoggerConfig{Format: LogFormatJSON, Output: output}), "/users/42?api_key=secret")
+	entry := accessLog{}
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Method != "GET" || entry.Path != "/users/42" || entry.Route != "/users/:id" || entry.Status != 200 ||
+		entry.Bytes != 4 || entry.IP != "10.0.0.1" || entry.UserAgent != "test-agent" {
+		t.Fatalf("wrong JSON entry %+v", entry)
+	}
+	if strings.Contains(output.String(), "secret") {
+		t.Fatalf("query string is logged: %s", output.String())
+	}
+}
+
+func TestLoggerSkipAndSample(t *testing.T) {
+	output := &bytes.Buffer{}
+	router := newLoggerTestRouter(LoggerConfig{Output: output, SkipPaths: []string{"/health", "/users/:id"}})
+	serveLogger(router, "/health")
+	serveLogger(router, "/users/42")
+	if output.Len() != 0 {
+		t.Fatalf("skipped paths are logged: %q", output.String())
+	}
+
+	router = newLoggerTestRouter(LoggerConfig{Output: output, SampleRate: 1e-12})
+	for i := 0; i < 10; i++ {
+		serveLogger(router, "/users/42")
+	}
+	if output.Len() != 0 {
+		t.Fatalf("not sampled requests are logged: %q", output.String())
+	}
+	serveLogger(router, "/fail")
+	if !strings.Contains(output.String(), `"GET /fail HTTP/1.1" 500`) {
+		t.Fatalf("server error is not logged: %q", output.String())
+	}
+}
+
+func TestLoggerSlogHandler(t *testing.T) {
+	output := &bytes.Buffer{}
+	router := newLoggerTestRouter(LoggerConfig{Handler: slog.NewJSONHandler(output, nil)})
+	router.Use(NewRequestIDMiddleware(RequestIDConfig{Generator: func() string { return "request-1" }}))
+
+	serveLogger(router, "/fail")
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["level"] != "ERROR" || record["msg"] != "request" || record["route"] != "/fail" ||
+		record["status"] != 500.0 || record["request_id"] != "request-1" || record["error"] != errLoggerTest.Error() {
+		t.Fatalf("wrong slog record %v", record)
+	}
+
+	output.Reset()
+	serveLogger(router, "/missing")
+	if !strings.Contains(output.String(), `"level":"WARN"`) {
+		t.Fatalf("client error is not logged as warning: %s", output.String())
+	}
+}
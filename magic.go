@@ -22,7 +22,13 @@ var (
 	MaxBytes             = int64(10000000)
 	errStaticRoute       = errors.New("can't add route to static route")
 	errStaticRouteParams = errors.New("can't add route to path which contains params")
+	errStaticHandle      = errors.New("handler is not static")
 	errMethod            = errors.New("invalid method")
+	errRouteName         = errors.New("route name already used")
+	errRouteNotFound     = errors.New("route with this name not found")
+	errURLParam          = errors.New("missing url param")
+	errEncoding          = errors.New("unsupported encoding")
+	errTrustedProxy      = errors.New("invalid trusted proxy")
 	magic                *Magic
 )
 
@@ -40,55 +46,106 @@ func NewMagic(port string) *Magic {
 
 // CreateRoute function
 // Create new or get old route
-// You can use middleware
+// You can use middleware, it is appended to middlewares of route
+// Middlewares run in order: global (magic.Use) -> parent route -> child route -> handler
 func (magic *Magic) CreateRoute(path string, middlewares ...Middleware) *Route {
-	router := magic.router.mainRoute.createRoute(path)
-	router.middlewares = middlewares
-	return router
+	return magic.router.mainRoute.CreateRoute(path, middlewares...)
+}
+
+// Use function
+// Add global middlewares, they run for every request, also if route not found
+func (magic *Magic) Use(middlewares ...Middleware) {
+	magic.router.Use(middlewares...)
+}
+
+// Pre function
+// Add middlewares which run before routing
+// They can change method or path, like context.Request.URL.Path = "/new"
+func (magic *Magic) Pre(middlewares ...Middleware) {
+	magic.router.Pre(middlewares...)
+}
+
+// Group function
+// Create new or get old route and call fn with it
+func (magic *Magic) Group(prefix string, fn func(route *Route)) *Route {
+	return magic.router.mainRoute.Group(prefix, fn)
 }
 
 // GET function
 // Add get handler to route
-func (magic *Magic) GET(path string, handler func(context *Context) error) {
-	magic.router.mainRoute.add(path, "GET", handler)
+// Middlewares run only for this handler
+func (magic *Magic) GET(path string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.add(path, "GET", handler, middlewares...)
 }
 
 // POST function
 // Add post handler to route
-func (magic *Magic) POST(path string, handler func(context *Context) error) {
-	magic.router.mainRoute.add(path, "POST", handler)
+// Middlewares run only for this handler
+func (magic *Magic) POST(path string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.add(path, "POST", handler, middlewares...)
 }
 
 // PUT function
 // Add put handler to route
-func (magic *Magic) PUT(path string, handler func(context *Context) error) {
-	magic.router.mainRoute.add(path, "PUT", handler)
+// Middlewares run only for this handler
+func (magic *Magic) PUT(path string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.add(path, "PUT", handler, middlewares...)
 }
 
 // DELETE function
 // Add delete handler to route
-func (magic *Magic) DELETE(path string, handler func(context *Context) error) {
-	magic.router.mainRoute.add(path, "DELETE", handler)
+// Middlewares run only for this handler
+func (magic *Magic) DELETE(path string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.add(path, "DELETE", handler, middlewares...)
 }
 
 // FILE function
 // Add get handler for file to route
-func (magic *Magic) FILE(path, fileName string) {
-	magic.router.mainRoute.FILE(path, fileName)
+func (magic *Magic) FILE(path, fileName string, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.FILE(path, fileName, middlewares...)
 }
 
 // STATIC function
 // Add static route
 // Full path must't contain params like "/a/:id/static"
-func (magic *Magic) STATIC(path, filePathName string) {
-	magic.router.mainRoute.STATIC(path, filePathName)
+// Set options by Static like magic.STATIC("/app", "./dist").Static(StaticConfig{SPA: true})
+// Static replaces all options, set Browse: true in it to keep listing of directories
+func (magic *Magic) STATIC(path, filePathName string, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.STATIC(path, filePathName, middlewares...)
 }
 
 // CUSTOM function
 // Can be STATIC or FILE
 // In static you can get filename in storage | context.Storage["fileName"]
-func (magic *Magic) CUSTOM(path, method string, handler func(context *Context) error) {
-	magic.router.mainRoute.CUSTOM(path, method, handler)
+func (magic *Magic) CUSTOM(path, method string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.CUSTOM(path, method, handler, middlewares...)
+}
+
+// URL function
+// Build url by name of handler like magic.URL("user.show", Values{"id": "1"}, nil)
+// Return error if name not found or required param missing
+func (magic *Magic) URL(name string, params Values, query ValuesArr) (string, error) {
+	return magic.router.URL(name, params, query)
+}
+
+// Routes function
+// Return all handlers with method, path, name and required permissions like "role:admin"
+func (magic *Magic) Routes() []RouteInfo {
+	return magic.router.Routes()
+}
+
+// SetCookieConfig function
+// Set defaults and keys of cookies like
+// config := magic.DefaultCookieConfig(); config.HashKeys = [][]byte{key}; m.SetCookieConfig(config)
+func (magic *Magic) SetCookieConfig(config CookieConfig) {
+	magic.router.SetCookieConfig(config)
+}
+
+// SetTrustedProxies function
+// Set proxies like "10.0.0.0/8" whose forwarding headers are trusted by context.RealIP
+// Without trusted proxies context.RealIP returns remote address
+func (magic *Magic) SetTrustedProxies(proxies ...string) {
+	magic.router.SetTrustedProxies(proxies...)
 }
 
 // SetMaxBytes function
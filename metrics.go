@@ -0,0 +1,250 @@
+package magic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultDurationBuckets - buckets of request duration histogram in seconds
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets - buckets of request and response size histograms in bytes
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// MetricsConfig structure
+// Namespace - prefix of metric names (default "magic")
+// DurationBuckets - buckets of duration histogram (default DefaultDurationBuckets)
+// SizeBuckets - buckets of size histograms (default DefaultSizeBuckets)
+type MetricsConfig struct {
+	Namespace       string
+	DurationBuckets []float64
+	SizeBuckets     []float64
+}
+
+// Metrics structure
+// Collect request metrics labelled by method, route pattern and status
+// Write them in Prometheus text exposition format
+type Metrics struct {
+	mutex         sync.Mutex
+	config        MetricsConfig
+	requests      map[metricLabels]float64
+	durations     map[metricLabels]*histogram
+	requestSizes  map[metricLabels]*histogram
+	responseSizes map[metricLabels]*histogram
+	inFlight      map[metricLabels]float64
+}
+
+type metricLabels struct {
+	method string
+	route  string
+	status string
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewMetrics function
+// Create new Metrics
+func NewMetrics(config MetricsConfig) *Metrics {
+	if config.Namespace == "" {
+		config.Namespace = "magic"
+	}
+	if config.DurationBuckets == nil {
+		config.DurationBuckets = DefaultDurationBuckets
+	}
+	if config.SizeBuckets == nil {
+		config.SizeBuckets = DefaultSizeBuckets
+	}
+	return &Metrics{
+		config:        config,
+		requests:      make(map[metricLabels]float64),
+		durations:     make(map[metricLabels]*histogram),
+		requestSizes:  make(map[metricLabels]*histogram),
+		responseSizes: make(map[metricLabels]*histogram),
+		inFlight:      make(map[metricLabels]float64),
+	}
+}
+
+// Metrics function
+// Collect metrics of all requests and serve them on path like "/metrics"
+func (magic *Magic) Metrics(path string) *Metrics {
+	metrics := NewMetrics(MetricsConfig{})
+	magic.Use(metrics.Middleware())
+	magic.GET(path, metrics.Handler())
+	return metrics
+}
+
+// Middleware function
+// Return middleware which collects metrics, use it in magic.Use
+func (metrics *Metrics) Middleware() Middleware {
+	return NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) error {
+			route := context.Route.FullPath()
+			if context.Route == nil {
+				route = "not_found"
+			}
+			method := metricMethod(context.Request.Method)
+			flightLabels := metricLabels{method: method, route: route}
+
+			metrics.mutex.Lock()
+			metrics.inFlight[flightLabels]++
+			metrics.mutex.Unlock()
+
+			start := time.Now()
+			err := next(context)
+			duration := time.Since(start).Seconds()
+
+			requestSize := float64(context.Request.ContentLength)
+			if requestSize < 0 {
+				requestSize = float64(len(context.Body))
+			}
+			labels := metricLabels{
+				method: method,
+				route:  route,
+				status: strconv.Itoa(context.Response.Status()),
+			}
+
+			metrics.mutex.Lock()
+			metrics.inFlight[flightLabels]--
+			metrics.requests[labels]++
+			metrics.observe(metrics.durations, labels, metrics.config.DurationBuckets, duration)
+			metrics.observe(metrics.requestSizes, labels, metrics.config.SizeBuckets, requestSize)
+			metrics.observe(metrics.responseSizes, labels, metrics.config.SizeBuckets, float64(context.Response.Size()))
+			metrics.mutex.Unlock()
+			return err
+		}
+	})
+}
+
+// Handler function
+// Return handler which sends metrics in Prometheus text format
+func (metrics *Metrics) Handler() HandlerFunc {
+	return func(context *Context) error {
+		context.Writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, err := metrics.WriteTo(context.Writer)
+		return err
+	}
+}
+
+// WriteTo function
+// Write metrics in Prometheus text format
+func (metrics *Metrics) WriteTo(writer io.Writer) (int64, error) {
+	buffer := &bytes.Buffer{}
+	name := metrics.config.Namespace + "_http_"
+
+	metrics.mutex.Lock()
+	writeMetricHeader(buffer, name+"requests_total", "counter", "Total number of HTTP requests.")
+	for _, labels := range sortedLabels(metrics.requests) {
+		fmt.Fprintf(buffer, "%srequests_total%s %s\n", name, labels.format(true, ""), formatMetricValue(metrics.requests[labels]))
+	}
+	writeMetricHeader(buffer, name+"requests_in_flight", "gauge", "Number of HTTP requests in progress.")
+	for _, labels := range sortedLabels(metrics.inFlight) {
+		fmt.Fprintf(buffer, "%srequests_in_flight%s %s\n", name, labels.format(false, ""), formatMetricValue(metrics.inFlight[labels]))
+	}
+	writeHistogram(buffer, name+"request_duration_seconds", "HTTP request latency in seconds.", metrics.durations)
+	writeHistogram(buffer, name+"request_size_bytes", "HTTP request size in bytes.", metrics.requestSizes)
+	writeHistogram(buffer, name+"response_size_bytes", "HTTP response size in bytes.", metrics.responseSizes)
+	metrics.mutex.Unlock()
+
+	n, err := writer.Write(buffer.Bytes())
+	return int64(n), err
+}
+
+// metricMethod function
+// Return standard method or "OTHER", so clients can't create new series by unknown methods
+func metricMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+func (metrics *Metrics) observe(histograms map[metricLabels]*histogram, labels metricLabels, buckets []float64, value float64) {
+	h := histograms[labels]
+	if h == nil {
+		h = &histogram{
+			buckets: buckets,
+			counts:  make([]uint64, len(buckets)),
+		}
+		histograms[labels] = h
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func writeMetricHeader(buffer *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buffer, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buffer, "# TYPE %s %s\n", name, kind)
+}
+
+func writeHistogram(buffer *bytes.Buffer, name, help string, histograms map[metricLabels]*histogram) {
+	writeMetricHeader(buffer, name, "histogram", help)
+	for _, labels := range sortedLabels(histograms) {
+		h := histograms[labels]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(buffer, "%s_bucket%s %d\n", name, labels.format(true, formatMetricValue(bound)), h.counts[i])
+		}
+		fmt.Fprintf(buffer, "%s_bucket%s %d\n", name, labels.format(true, "+Inf"), h.count)
+		fmt.Fprintf(buffer, "%s_sum%s %s\n", name, labels.format(true, ""), formatMetricValue(h.sum))
+		fmt.Fprintf(buffer, "%s_count%s %d\n", name, labels.format(true, ""), h.count)
+	}
+}
+
+func sortedLabels[T any](values map[metricLabels]T) []metricLabels {
+	labels := make([]metricLabels, 0, len(values))
+	for key := range values {
+		labels = append(labels, key)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].route != labels[j].route {
+			return labels[i].route < labels[j].route
+		}
+		if labels[i].method != labels[j].method {
+			return labels[i].method < labels[j].method
+		}
+		return labels[i].status < labels[j].status
+	})
+	return labels
+}
+
+func (labels metricLabels) format(withStatus bool, le string) string {
+	result := `{method="` + escapeLabelValue(labels.method) + `",route="` + escapeLabelValue(labels.route) + `"`
+	if withStatus {
+		result += `,status="` + escapeLabelValue(labels.status) + `"`
+	}
+	if le != "" {
+		result += `,le="` + le + `"`
+	}
+	return result + "}"
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
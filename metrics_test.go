@@ -0,0 +1,54 @@
+package magic
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsWriteTo(t *testing.T) {
+	metrics := NewMetrics(MetricsConfig{
+		Namespace:   "test",
+		SizeBuckets: []float64{1, 100},
+	})
+	router := NewRouter()
+	router.Use(metrics.Middleware())
+	router.mainRoute.GET("/users/:id", func(context *Context) error {
+		return context.SendString("hello")
+	})
+	for _, method := range []string{"GET", "GET", "JUNK0", "JUNK1", "JUNK2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/users/1", nil))
+	}
+
+	buffer := &bytes.Buffer{}
+	if _, err := metrics.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	output := buffer.String()
+	expected := []string{
+		"# HELP test_http_requests_total Total number of HTTP requests.\n" +
+			"# TYPE test_http_requests_total counter\n" +
+			`test_http_requests_total{method="GET",route="/users/:id",status="200"} 2` + "\n" +
+			`test_http_requests_total{method="OTHER",route="not_found",status="404"} 3` + "\n",
+		"# TYPE test_http_requests_in_flight gauge\n" +
+			`test_http_requests_in_flight{method="GET",route="/users/:id"} 0` + "\n" +
+			`test_http_requests_in_flight{method="OTHER",route="not_found"} 0` + "\n",
+		"# TYPE test_http_request_duration_seconds histogram\n",
+		`test_http_request_duration_seconds_count{method="GET",route="/users/:id",status="200"} 2` + "\n",
+		"# TYPE test_http_response_size_bytes histogram\n" +
+			`test_http_response_size_bytes_bucket{method="GET",route="/users/:id",status="200",le="1"} 0` + "\n" +
+			`test_http_response_size_bytes_bucket{method="GET",route="/users/:id",status="200",le="100"} 2` + "\n" +
+			`test_http_response_size_bytes_bucket{method="GET",route="/users/:id",status="200",le="+Inf"} 2` + "\n" +
+			`test_http_response_size_bytes_sum{method="GET",route="/users/:id",status="200"} 10` + "\n" +
+			`test_http_response_size_bytes_count{method="GET",route="/users/:id",status="200"} 2` + "\n",
+	}
+	for _, part := range expected {
+		if !strings.Contains(output, part) {
+			t.Fatalf("output doesn't contain:\n%s\noutput:\n%s", part, output)
+		}
+	}
+	if strings.Contains(output, "JUNK") {
+		t.Fatalf("unknown method in output:\n%s", output)
+	}
+}
@@ -1,66 +1,135 @@
 package magic
 
 import (
+	"log"
+	"net/http"
+	"runtime/debug"
 	"strings"
-	"time"
-
-	jwt "github.com/dgrijalva/jwt-go"
 )
 
+// HandlerFunc type
+// Handler of request
+type HandlerFunc func(context *Context) error
+
+// MiddlewareFunc type
+// Middleware which wraps next handler
+// It can run code before and after next(context)
+type MiddlewareFunc func(next HandlerFunc) HandlerFunc
+
 // Middleware structure
 type Middleware struct {
-	run func(*Context) error
+	run         func(*Context) error
+	wrap        MiddlewareFunc
+	permissions []string
 }
 
 // NewMiddleware function
 // Create new Middleware
+// Next middleware (or handler) runs only if handler returns nil
 func NewMiddleware(handler func(context *Context) error) Middleware {
 	return Middleware{
 		run: handler,
 	}
 }
 
-// NewJWTMiddleware function
-// Create new JWT authorization middleware
-// Claims will contains in context.Storage["claims"]
-// contex.Storage["claims"] -> map[string]interface{}
-func NewJWTMiddleware(secretKey, headerName string) Middleware {
-	return NewMiddleware(func(context *Context) error {
-		tokenWithBearer, err := context.Headers.ParseString(headerName)
-		if err != nil {
-			return context.SendErrorString("miss or invalid JWT")
-		}
+// NewWrapMiddleware function
+// Create new Middleware from MiddlewareFunc
+// Like func(next HandlerFunc) HandlerFunc { return func(context *Context) error { ...; err := next(context); ...; return err } }
+func NewWrapMiddleware(wrap MiddlewareFunc) Middleware {
+	return Middleware{
+		wrap: wrap,
+	}
+}
 
-		mas := strings.Split(tokenWithBearer, " ")
-		if len(mas) != 2 {
-			return context.SendErrorString("miss or invalid JWT")
+// Wrap function
+// Return middleware as MiddlewareFunc
+// Middleware from NewMiddleware calls next only if it returns nil
+func (middleware Middleware) Wrap() MiddlewareFunc {
+	if middleware.wrap != nil {
+		return middleware.wrap
+	}
+	run := middleware.run
+	return func(next HandlerFunc) HandlerFunc {
+		if run == nil {
+			return next
 		}
-
-		tokenStr := mas[1]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			tokenTime := (token.Claims.(jwt.MapClaims))["exp"].(float64)
-			if time.Now().UnixNano()-int64(tokenTime) > 0 {
-				return nil, context.SendErrorString("miss or invalid JWT")
+		return func(context *Context) error {
+			err := run(context)
+			if err != nil {
+				return err
 			}
-			return []byte(secretKey), nil
-		})
-
-		if err != nil || token.Valid == false {
-			return context.SendErrorString("miss or invalid JWT")
+			return next(context)
 		}
+	}
+}
+
+func chainHandler(middlewares []Middleware, handler HandlerFunc) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i].Wrap()(handler)
+	}
+	return handler
+}
 
-		claims := token.Claims.(jwt.MapClaims)
-		context.Storage["claims"] = map[string]interface{}(claims)
+// NewRecoverMiddleware function
+// Create new middleware which recovers panic in next middlewares and handler
+// Panic is logged with request id and stack, client gets status 500
+func NewRecoverMiddleware() Middleware {
+	return NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) (err error) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				log.Printf("panic recovered: request_id=%s method=%s path=%s: %v\n%s",
+					context.RequestID, context.Request.Method, context.Request.URL.Path, recovered, debug.Stack())
+				if !context.Response.Written() {
+					context.Writer.WriteHeader(http.StatusInternalServerError)
+				}
+				err = context.SendErrorString("internal server error")
+			}()
+			return next(context)
+		}
+	})
+}
 
+// NewMethodOverrideMiddleware function
+// Create new pre middleware, use it in magic.Pre
+// Change POST method by header X-HTTP-Method-Override or form field _method to PUT, PATCH or DELETE
+func NewMethodOverrideMiddleware() Middleware {
+	return NewMiddleware(func(context *Context) error {
+		request := context.Request
+		if request.Method != "POST" {
+			return nil
+		}
+		method := request.Header.Get("X-HTTP-Method-Override")
+		if method == "" && strings.HasPrefix(request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			method = request.PostFormValue("_method")
+		}
+		method = strings.ToUpper(method)
+		switch method {
+		case "PUT", "PATCH", "DELETE":
+			request.Method = method
+		}
 		return nil
 	})
 }
 
-// GenerateJWTToken function
-// Use your claims, your method, secretKey and time
-// Generate token and return it
-func GenerateJWTToken(claims map[string]interface{}, method *jwt.SigningMethodHMAC, secretKey string, duration time.Duration) (string, error) {
-	claims["exp"] = time.Now().UnixNano() + duration.Nanoseconds()
-	token := jwt.NewWithClaims(method, jwt.MapClaims(claims))
-	return token.SignedString([]byte(secretKey))
+// NewTrailingSlashMiddleware function
+// Create new pre middleware, use it in magic.Pre
+// Remove trailing slash from path like "/users/" -> "/users"
+func NewTrailingSlashMiddleware() Middleware {
+	return NewMiddleware(func(context *Context) error {
+		path := context.Request.URL.Path
+		if len(path) > 1 && strings.HasSuffix(path, "/") {
+			context.Request.URL.Path = strings.TrimRight(path, "/")
+			if context.Request.URL.Path == "" {
+				context.Request.URL.Path = "/"
+			}
+		}
+		return nil
+	})
 }
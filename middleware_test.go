@@ -0,0 +1,102 @@
+package magic
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	order := []string{}
+	record := func(name string) Middleware {
+		return NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+			return func(context *Context) error {
+				order = append(order, name)
+				err := next(context)
+				order = append(order, "/"+name)
+				return err
+			}
+		})
+	}
+
+	m := NewMagic("0")
+	m.Use(record("global"))
+	m.CreateRoute("/api", record("route1"))
+	api := m.CreateRoute("/api", record("route2"))
+	api.Group("/v1", func(route *Route) {
+		route.Use(record("group"))
+		route.GET("/users", func(context *Context) error {
+			order = append(order, "handler")
+			return nil
+		}, record("handle"))
+	})
+	m.GET("/other", func(context *Context) error { return nil })
+
+	m.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users", nil))
+	expected := "global route1 route2 group handle handler /handle /group /route2 /route1 /global"
+	if result := strings.Join(order, " "); result != expected {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+
+	order = []string{}
+	m.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other", nil))
+	if result := strings.Join(order, " "); result != "global /global" {
+		t.Fatalf("expected only global middleware, got %q", result)
+	}
+}
+
+func TestPreMiddlewares(t *testing.T) {
+	m := NewMagic("0")
+	m.Pre(NewTrailingSlashMiddleware(), NewMethodOverrideMiddleware())
+	handler := func(context *Context) error {
+		return context.SendString(context.Request.Method + " " + context.Request.URL.Path)
+	}
+	m.GET("/users", handler)
+	m.POST("/users", handler)
+	m.PUT("/users", handler)
+	m.DELETE("/users", handler)
+
+	cases := []struct {
+		name     string
+		method   string
+		path     string
+		header   string
+		form     string
+		expected string
+	}{
+		{"trailing slash", "GET", "/users/", "", "", "GET /users"},
+		{"trailing slashes", "GET", "/users///", "", "", "GET /users"},
+		{"override by header", "POST", "/users", "delete", "", "DELETE /users"},
+		{"override by form", "POST", "/users/", "", "_method=PUT", "PUT /users"},
+		{"override to GET", "POST", "/users", "GET", "", "POST /users"},
+		{"override of GET", "GET", "/users", "DELETE", "", "GET /users"},
+	}
+	for _, test := range cases {
+		request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.form))
+		if test.form != "" {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if test.header != "" {
+			request.Header.Set("X-HTTP-Method-Override", test.header)
+		}
+		recorder := httptest.NewRecorder()
+		m.router.ServeHTTP(recorder, request)
+		if recorder.Body.String() != test.expected {
+			t.Fatalf("%s: expected %q, got %q", test.name, test.expected, recorder.Body.String())
+		}
+	}
+}
+
+func TestGlobalMiddlewareOnNotFound(t *testing.T) {
+	m := NewMagic("0")
+	m.Use(NewMiddleware(func(context *Context) error {
+		context.Writer.Header().Set("X-Global", "yes")
+		return nil
+	}))
+	m.GET("/users", func(context *Context) error { return nil })
+	recorder := httptest.NewRecorder()
+	m.router.ServeHTTP(recorder, httptest.NewRequest("GET", "/missing", nil))
+	if recorder.Code != 404 || recorder.Header().Get("X-Global") != "yes" {
+		t.Fatalf("global middleware doesn't run for 404: %d %v", recorder.Code, recorder.Header())
+	}
+}
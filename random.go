@@ -0,0 +1,14 @@
+package magic
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// randomID function
+// Return random id of 32 hex chars for request ids, token ids and sessions
+func randomID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
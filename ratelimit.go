@@ -0,0 +1,272 @@
+package magic
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rate limit algorithms
+const (
+	RateLimitTokenBucket   = "token_bucket"
+	RateLimitSlidingWindow = "sliding_window"
+)
+
+var (
+	errRateLimitAlgorithm = errors.New("unknown rate limit algorithm")
+	errRateLimitPolicy    = errors.New("rate limit must have positive limit and window")
+)
+
+// RateLimitPolicy structure
+// Algorithm - RateLimitTokenBucket or RateLimitSlidingWindow
+// Limit - count of requests in Window
+// Window - duration of window, token bucket gets Limit tokens per Window
+type RateLimitPolicy struct {
+	Algorithm string
+	Limit     int
+	Window    time.Duration
+}
+
+// RateLimitResult structure
+// Allowed - request can be done
+// Remaining - count of requests which can be done now
+// Reset - time until limit is fully available again
+// RetryAfter - time until next request can be done, 0 if allowed
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore interface
+// Store of rate limit state, implement it to use Redis or other storage
+type RateLimitStore interface {
+	Allow(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitConfig structure
+// Policy - algorithm and limit
+// KeyFunc - return key of client (default RateLimitByIP())
+// Store - storage (default NewMemoryRateLimitStore())
+type RateLimitConfig struct {
+	Policy  RateLimitPolicy
+	KeyFunc func(context *Context) (string, error)
+	Store   RateLimitStore
+}
+
+// NewRateLimitMiddleware function
+// Create new rate limit middleware
+// Send RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers
+// Send 429 with Retry-After if limit exceeded
+// If KeyFunc or Store return error request is not limited
+func NewRateLimitMiddleware(config RateLimitConfig) Middleware {
+	policy := config.Policy
+	switch policy.Algorithm {
+	case "":
+		policy.Algorithm = RateLimitTokenBucket
+	case RateLimitTokenBucket, RateLimitSlidingWindow:
+	default:
+		panic(errRateLimitAlgorithm.Error() + ": " + policy.Algorithm)
+	}
+	if policy.Limit <= 0 || policy.Window <= 0 {
+		panic(errRateLimitPolicy)
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = RateLimitByIP()
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+	prefix := fmt.Sprintf("%s:%d:%d:", policy.Algorithm, policy.Limit, policy.Window)
+
+	return NewMiddleware(func(context *Context) error {
+		key, err := config.KeyFunc(context)
+		if err != nil {
+			return nil
+		}
+		result, err := config.Store.Allow(prefix+key, policy, time.Now())
+		if err != nil {
+			return nil
+		}
+
+		header := context.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Window)))
+		if result.Allowed {
+			return nil
+		}
+		header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		context.Writer.WriteHeader(http.StatusTooManyRequests)
+		return context.SendErrorString("too many requests")
+	})
+}
+
+// RateLimitByIP function
+// Return key function which uses ip of client from context.RealIP
+// It is remote address, set magic.SetTrustedProxies if server is behind proxy
+func RateLimitByIP() func(context *Context) (string, error) {
+	return func(context *Context) (string, error) {
+		return "ip:" + context.RealIP(), nil
+	}
+}
+
+// RateLimitByClaim function
+// Return key function which uses claim from context.Storage[ClaimsKey]
+// If there is no claim ip of client is used
+func RateLimitByClaim(claim string) func(context *Context) (string, error) {
+	return func(context *Context) (string, error) {
+		claims, ok := context.Storage[ClaimsKey].(map[string]interface{})
+		if ok && claims[claim] != nil {
+			return "claim:" + fmt.Sprint(claims[claim]), nil
+		}
+		return "ip:" + context.RealIP(), nil
+	}
+}
+
+func ceilSeconds(duration time.Duration) int {
+	if duration <= 0 {
+		return 0
+	}
+	return int(math.Ceil(duration.Seconds()))
+}
+
+// MemoryRateLimitStore structure
+// RateLimitStore which keeps state in memory of process
+type MemoryRateLimitStore struct {
+	mutex       sync.Mutex
+	buckets     map[string]*tokenBucket
+	windows     map[string]*slidingWindow
+	lastCleanup time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration
+}
+
+type slidingWindow struct {
+	start    time.Time
+	current  int
+	previous int
+	window   time.Duration
+}
+
+// NewMemoryRateLimitStore function
+// Create new MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:     make(map[string]*tokenBucket),
+		windows:     make(map[string]*slidingWindow),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Allow function
+// Take one request from limit of key
+func (store *MemoryRateLimitStore) Allow(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if now.Sub(store.lastCleanup) > time.Minute {
+		store.cleanup(now)
+	}
+	switch policy.Algorithm {
+	case RateLimitTokenBucket:
+		return store.allowTokenBucket(key, policy, now), nil
+	case RateLimitSlidingWindow:
+		return store.allowSlidingWindow(key, policy, now), nil
+	default:
+		return RateLimitResult{}, errRateLimitAlgorithm
+	}
+}
+
+func (store *MemoryRateLimitStore) allowTokenBucket(key string, policy RateLimitPolicy, now time.Time) RateLimitResult {
+	limit := float64(policy.Limit)
+	rate := limit / policy.Window.Seconds()
+	bucket := store.buckets[key]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: limit, last: now, window: policy.Window}
+		store.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(limit, bucket.tokens+elapsed*rate)
+		bucket.last = now
+	}
+
+	result := RateLimitResult{Limit: policy.Limit}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration((limit - bucket.tokens) / rate * float64(time.Second))
+	return result
+}
+
+func (store *MemoryRateLimitStore) allowSlidingWindow(key string, policy RateLimitPolicy, now time.Time) RateLimitResult {
+	window := store.windows[key]
+	if window == nil {
+		window = &slidingWindow{start: now.Truncate(policy.Window), window: policy.Window}
+		store.windows[key] = window
+	}
+	if elapsed := now.Sub(window.start); elapsed >= policy.Window {
+		windows := int(elapsed / policy.Window)
+		window.previous = window.current
+		if windows > 1 {
+			window.previous = 0
+		}
+		window.current = 0
+		window.start = window.start.Add(time.Duration(windows) * policy.Window)
+	}
+
+	elapsed := now.Sub(window.start)
+	weight := 1 - float64(elapsed)/float64(policy.Window)
+	estimate := float64(window.previous)*weight + float64(window.current)
+
+	result := RateLimitResult{
+		Limit: policy.Limit,
+		Reset: policy.Window - elapsed,
+	}
+	if estimate+1 <= float64(policy.Limit) {
+		window.current++
+		estimate++
+		result.Allowed = true
+	} else if window.current+1 > policy.Limit || window.previous == 0 {
+		// wait for next window, then until weight of this window allows one more request
+		needed := 1 - float64(policy.Limit-1)/float64(window.current)
+		result.RetryAfter = policy.Window - elapsed + time.Duration(needed*float64(policy.Window))
+	} else {
+		// wait until weight of previous window allows one more request
+		needed := 1 - float64(policy.Limit-window.current-1)/float64(window.previous)
+		result.RetryAfter = time.Duration(needed*float64(policy.Window)) - elapsed
+	}
+	result.Remaining = int(float64(policy.Limit) - estimate)
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	return result
+}
+
+func (store *MemoryRateLimitStore) cleanup(now time.Time) {
+	store.lastCleanup = now
+	for key, bucket := range store.buckets {
+		if now.Sub(bucket.last) > bucket.window {
+			delete(store.buckets, key)
+		}
+	}
+	for key, window := range store.windows {
+		if now.Sub(window.start) > 2*window.window {
+			delete(store.windows, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package magic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitByIPIgnoresSpoofedHeaders(t *testing.T) {
+	router := NewRouter()
+	router.Use(NewRateLimitMiddleware(RateLimitConfig{
+		Policy: RateLimitPolicy{Limit: 1, Window: time.Hour},
+	}))
+	router.mainRoute.GET("/", func(context *Context) error {
+		return context.SendString("ok")
+	})
+	for i := 0; i < 5; i++ {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = "203.0.113.7:1234"
+		request.Header.Set("X-Forwarded-For", "198.51.100."+strconv.Itoa(i))
+		request.Header.Set("X-Real-IP", "198.51.100."+strconv.Itoa(i))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		expected := http.StatusTooManyRequests
+		if i == 0 {
+			expected = http.StatusOK
+		}
+		if recorder.Code != expected {
+			t.Fatalf("request %d: expected %d, got %d", i, expected, recorder.Code)
+		}
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	router := NewRouter()
+	router.SetTrustedProxies("10.0.0.0/8", "192.0.2.1")
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		expected   string
+	}{
+		{"untrusted remote", "203.0.113.7:1", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"trusted remote", "10.0.0.1:1", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"right-most untrusted hop", "10.0.0.1:1", []string{"1.1.1.1, 198.51.100.1, 10.0.0.2"}, "", "198.51.100.1"},
+		{"several headers", "192.0.2.1:1", []string{"1.1.1.1", "198.51.100.1"}, "", "198.51.100.1"},
+		{"all hops trusted", "10.0.0.1:1", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"X-Real-IP from trusted proxy", "10.0.0.1:1", nil, "198.51.100.2", "198.51.100.2"},
+		{"no headers", "10.0.0.1:1", nil, "", "10.0.0.1"},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = test.remoteAddr
+			for _, forwarded := range test.forwarded {
+				request.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if test.realIP != "" {
+				request.Header.Set("X-Real-IP", test.realIP)
+			}
+			context := getContext(httptest.NewRecorder(), request)
+			context.router = router
+			if ip := context.RealIP(); ip != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, ip)
+			}
+		})
+	}
+}
+
+func TestSetTrustedProxiesPanicsOnInvalidProxy(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on invalid proxy")
+		}
+	}()
+	NewRouter().SetTrustedProxies("proxy.local")
+}
@@ -0,0 +1,43 @@
+package magic
+
+// RequestIDConfig structure
+// HeaderName - header with request id (default "X-Request-ID")
+// Generator - function which generates new request id (default random 32 hex chars)
+type RequestIDConfig struct {
+	HeaderName string
+	Generator  func() string
+}
+
+// NewRequestIDMiddleware function
+// Create new request id middleware
+// Take request id from header or generate new, put it to context.RequestID and response header
+// Use it in magic.Use so not found requests also get request id
+func NewRequestIDMiddleware(config RequestIDConfig) Middleware {
+	if config.HeaderName == "" {
+		config.HeaderName = "X-Request-ID"
+	}
+	if config.Generator == nil {
+		config.Generator = randomID
+	}
+	return NewMiddleware(func(context *Context) error {
+		requestID := context.Request.Header.Get(config.HeaderName)
+		if !validRequestID(requestID) {
+			requestID = config.Generator()
+		}
+		context.RequestID = requestID
+		context.Writer.Header().Set(config.HeaderName, requestID)
+		return nil
+	})
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+	for _, c := range requestID {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
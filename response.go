@@ -0,0 +1,148 @@
+package magic
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+var (
+	errHijack = errors.New("response writer can't be hijacked")
+)
+
+// Response structure
+// Wrapper of http.ResponseWriter
+// Record status, size and write state
+// Support http.Flusher, http.Hijacker and http.Pusher if writer supports it
+type Response struct {
+	writer      http.ResponseWriter
+	status      int
+	size        int64
+	written     bool
+	beforeFuncs []func()
+	afterFuncs  []func()
+}
+
+// NewResponse function
+// Create new Response
+func NewResponse(writer http.ResponseWriter) *Response {
+	return &Response{
+		writer: writer,
+		status: http.StatusOK,
+	}
+}
+
+// Header function
+// Return headers of response
+func (response *Response) Header() http.Header {
+	return response.writer.Header()
+}
+
+// WriteHeader function
+// Send status and headers, only first call does something
+func (response *Response) WriteHeader(status int) {
+	if response.written {
+		return
+	}
+	response.status = status
+	for _, fn := range response.beforeFuncs {
+		fn()
+	}
+	response.written = true
+	response.writer.WriteHeader(response.status)
+}
+
+// Write function
+// Write bytes to response, send status 200 if status not sent
+func (response *Response) Write(bytes []byte) (int, error) {
+	if !response.written {
+		response.WriteHeader(http.StatusOK)
+	}
+	n, err := response.writer.Write(bytes)
+	response.size += int64(n)
+	for _, fn := range response.afterFuncs {
+		fn()
+	}
+	return n, err
+}
+
+// Status function
+// Return sent status or 200
+func (response *Response) Status() int {
+	return response.status
+}
+
+// Size function
+// Return count of written bytes of body
+func (response *Response) Size() int64 {
+	return response.size
+}
+
+// Written function
+// Return true if status and headers already sent
+func (response *Response) Written() bool {
+	return response.written
+}
+
+// Before function
+// Add function which runs before status and headers are sent
+// You can change headers or status in it
+func (response *Response) Before(fn func()) {
+	response.beforeFuncs = append(response.beforeFuncs, fn)
+}
+
+// After function
+// Add function which runs after each write of body
+func (response *Response) After(fn func()) {
+	response.afterFuncs = append(response.afterFuncs, fn)
+}
+
+// SetStatus function
+// Change status in Before function
+func (response *Response) SetStatus(status int) {
+	if !response.written {
+		response.status = status
+	}
+}
+
+// Flush function
+// Implement http.Flusher
+func (response *Response) Flush() {
+	if !response.written {
+		response.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := response.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack function
+// Implement http.Hijacker
+func (response *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := response.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijack
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		response.written = true
+	}
+	return conn, rw, err
+}
+
+// Push function
+// Implement http.Pusher
+func (response *Response) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := response.writer.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+// Unwrap function
+// Return original http.ResponseWriter, used by http.ResponseController
+func (response *Response) Unwrap() http.ResponseWriter {
+	return response.writer
+}
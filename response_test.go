@@ -0,0 +1,99 @@
+package magic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseState(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	response := NewResponse(recorder)
+	if response.Status() != http.StatusOK || response.Size() != 0 || response.Written() {
+		t.Fatalf("wrong initial state %d %d %v", response.Status(), response.Size(), response.Written())
+	}
+	response.WriteHeader(http.StatusCreated)
+	response.WriteHeader(http.StatusInternalServerError)
+	response.SetStatus(http.StatusAccepted)
+	response.Write([]byte("hello"))
+	response.Write([]byte(" world"))
+	if response.Status() != http.StatusCreated || response.Size() != 11 || !response.Written() {
+		t.Fatalf("wrong state %d %d %v", response.Status(), response.Size(), response.Written())
+	}
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != "hello world" {
+		t.Fatalf("wrong response %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	response = NewResponse(recorder)
+	response.Write([]byte("ok"))
+	if response.Status() != http.StatusOK || !response.Written() || recorder.Code != http.StatusOK {
+		t.Fatalf("Write doesn't send 200: %d %d", response.Status(), recorder.Code)
+	}
+
+	response = NewResponse(recorder)
+	response.Flush()
+	if !response.Written() || !recorder.Flushed || response.Unwrap() != recorder {
+		t.Fatal("Flush doesn't send headers")
+	}
+	if _, _, err := response.Hijack(); err != errHijack {
+		t.Fatalf("expected %q, got %v", errHijack, err)
+	}
+	if err := response.Push("/app.js", nil); err != http.ErrNotSupported {
+		t.Fatalf("expected %q, got %v", http.ErrNotSupported, err)
+	}
+}
+
+func TestResponseHooks(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	response := NewResponse(recorder)
+	calls := []string{}
+	response.Before(func() {
+		calls = append(calls, "before1")
+		response.Header().Set("X-Before", "yes")
+		response.SetStatus(http.StatusTeapot)
+	})
+	response.Before(func() {
+		calls = append(calls, "before2")
+	})
+	response.After(func() {
+		calls = append(calls, "after")
+	})
+	response.Write([]byte("a"))
+	response.Write([]byte("b"))
+	response.WriteHeader(http.StatusOK)
+
+	if result := strings.Join(calls, " "); result != "before1 before2 after after" {
+		t.Fatalf("wrong order of hooks %q", result)
+	}
+	if recorder.Code != http.StatusTeapot || response.Status() != http.StatusTeapot || recorder.Header().Get("X-Before") != "yes" {
+		t.Fatalf("Before can't change status and headers: %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestSendErrorAfterPartialWrite(t *testing.T) {
+	router := NewRouter()
+	router.Use(NewRequestIDMiddleware(RequestIDConfig{Generator: func() string { return "request-1" }}))
+	router.mainRoute.GET("/partial", func(context *Context) error {
+		context.Writer.Write([]byte(`{"items": [`))
+		return context.SendError(errForbidden)
+	})
+	router.mainRoute.GET("/headers", func(context *Context) error {
+		context.Writer.WriteHeader(http.StatusForbidden)
+		return context.SendError(errForbidden)
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/partial", nil))
+	if body := recorder.Body.String(); body != `{"items": [` {
+		t.Fatalf("error is appended to partial body: %q", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/headers", nil))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusForbidden || !strings.Contains(body, `"message": "forbidden"`) || !strings.Contains(body, `"request_id": "request-1"`) {
+		t.Fatalf("error is not sent after headers: %d %q", recorder.Code, body)
+	}
+}
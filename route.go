@@ -1,7 +1,10 @@
 package magic
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -17,6 +20,46 @@ type Route struct {
 	path          string
 	fullPath      string
 	isStatic      bool
+	router        *Router
+	handles       map[string]*RouteHandle
+}
+
+// RouteHandle structure
+// Returned by GET, POST, ... and points to added handler
+type RouteHandle struct {
+	route       *Route
+	method      string
+	name        string
+	middlewares []Middleware
+	static      *staticServer
+}
+
+// Name function
+// Set name of handler, use it in magic.URL("name", ...)
+// Name must be unique
+func (handle *RouteHandle) Name(name string) *RouteHandle {
+	router := handle.route.router
+	if router != nil {
+		if _, ok := router.names[name]; ok {
+			panic(errRouteName.Error() + ": " + name)
+		}
+		if handle.name != "" {
+			delete(router.names, handle.name)
+		}
+		router.names[name] = handle
+	}
+	handle.name = name
+	return handle
+}
+
+// RouteInfo structure
+// Description of handler returned by magic.Routes()
+// Permissions - roles, scopes and policies required by middlewares like "role:admin"
+type RouteInfo struct {
+	Method      string
+	Path        string
+	Name        string
+	Permissions []string
 }
 
 // NewRoute function
@@ -26,96 +69,125 @@ func NewRoute(path string) *Route {
 		path: path,
 	}
 	route.branches = make(map[string]*Route)
+	route.handles = make(map[string]*RouteHandle)
 	return route
 }
 
+// FullPath function
+// Return path of route with params like "/users/:id"
+func (route *Route) FullPath() string {
+	if route == nil {
+		return ""
+	}
+	if route.fullPath == "" {
+		return "/"
+	}
+	return route.fullPath
+}
+
 // CreateRoute function
 // Create new or get old route
-// You can use middleware
+// You can use middleware, it is appended to middlewares of route
+// Middlewares run in order: global (magic.Use) -> parent route -> child route -> handler
 func (route *Route) CreateRoute(path string, middlewares ...Middleware) *Route {
 	router := route.createRoute(path)
-	router.middlewares = middlewares
+	router.Use(middlewares...)
 	return router
 }
 
+// Group function
+// Create new or get old route and call fn with it
+// Handlers added in fn get all middlewares of route and its parents
+func (route *Route) Group(prefix string, fn func(route *Route)) *Route {
+	router := route.createRoute(prefix)
+	fn(router)
+	return router
+}
+
+// Use function
+// Append middlewares to route
+// They run for all handlers of route and its children
+func (route *Route) Use(middlewares ...Middleware) *Route {
+	route.middlewares = append(route.middlewares, middlewares...)
+	return route
+}
+
 // GET function
 // Add get handler to route
-func (route *Route) GET(path string, handler func(context *Context) error) {
-	route.add(path, "GET", handler)
+// Middlewares run only for this handler, after middlewares of routes
+func (route *Route) GET(path string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return route.add(path, "GET", handler, middlewares...)
 }
 
 // POST function
 // Add post handler to route
-func (route *Route) POST(path string, handler func(context *Context) error) {
-	route.add(path, "POST", handler)
+// Middlewares run only for this handler, after middlewares of routes
+func (route *Route) POST(path string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return route.add(path, "POST", handler, middlewares...)
 }
 
 // PUT function
 // Add put handler to route
-func (route *Route) PUT(path string, handler func(context *Context) error) {
-	route.add(path, "PUT", handler)
+// Middlewares run only for this handler, after middlewares of routes
+func (route *Route) PUT(path string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return route.add(path, "PUT", handler, middlewares...)
 }
 
 // DELETE function
 // Add delete handler to route
-func (route *Route) DELETE(path string, handler func(context *Context) error) {
-	route.add(path, "DELETE", handler)
+// Middlewares run only for this handler, after middlewares of routes
+func (route *Route) DELETE(path string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
+	return route.add(path, "DELETE", handler, middlewares...)
 }
 
 // FILE function
 // Add get handler for file to route
-func (route *Route) FILE(path, fileName string) {
-	route.add(path, "GET", func(context *Context) error {
+func (route *Route) FILE(path, fileName string, middlewares ...Middleware) *RouteHandle {
+	return route.add(path, "GET", func(context *Context) error {
 		http.ServeFile(context.Writer, context.Request, fileName)
 		return nil
-	})
+	}, middlewares...)
 }
 
 // STATIC function
 // Add static route
 // Full path must't contain params like "/a/:id/static"
-func (route *Route) STATIC(path, filePathName string) {
-	if strings.Contains(route.fullPath+path, ":") {
-		panic(errStaticRouteParams.Error() + ": " + route.fullPath + path)
-	}
-	route.add(path, "STATIC", func(context *Context) error {
-		fileName := strings.SplitN(context.Request.URL.Path, route.fullPath+path, 2)[1]
-		http.ServeFile(context.Writer, context.Request, filePathName+fileName)
-		return nil
-	})
+// Directories without index file are listed, files which start with "." are hidden
+// For cache headers, ETag, SPA and other options use magic.STATIC("/app", "./dist").Static(StaticConfig{...})
+// Static replaces all options, set Browse: true in it to keep listing of directories
+func (route *Route) STATIC(path, filePathName string, middlewares ...Middleware) *RouteHandle {
+	return route.STATICFileSystem(path, http.Dir(filePathName), StaticConfig{Browse: true}, middlewares...)
 }
 
 // CUSTOM function
 // Can be STATIC or FILE
 // In static you can get filename in storage | context.Storage["fileName"]
-func (route *Route) CUSTOM(path, method string, handler func(context *Context) error) {
+func (route *Route) CUSTOM(path, method string, handler func(context *Context) error, middlewares ...Middleware) *RouteHandle {
 	switch method {
 	case "STATIC":
 		if strings.Contains(route.fullPath+path, ":") {
 			panic(errStaticRouteParams.Error() + ": " + route.fullPath + path)
 		}
-		route.add(path, method, func(context *Context) error {
+		return route.add(path, method, func(context *Context) error {
 			fileName := strings.SplitN(context.Request.URL.Path, route.fullPath+path+"/", 2)[1]
 			context.Storage["fileName"] = fileName
 			return handler(context)
-		})
-		break
+		}, middlewares...)
 	case "FILE":
-		route.add(path, "GET", func(context *Context) error {
+		return route.add(path, "GET", func(context *Context) error {
 			return handler(context)
-		})
-		break
+		}, middlewares...)
 	default:
 		panic(errMethod)
 	}
 }
 
-func (route *Route) add(path, method string, handler func(*Context) error) {
+func (route *Route) add(path, method string, handler func(*Context) error, middlewares ...Middleware) *RouteHandle {
 	nowRoute := route
 	branches := strings.Split(path, "/")
 	if len(branches) == 2 && branches[1] == "" {
-		setMethod(nowRoute, method, "", handler)
-		return
+		setMethod(nowRoute, method, route.fullPath, handler)
+		return setHandle(nowRoute, method, middlewares)
 	}
 	len := len(branches)
 	for i := 1; i < len; i++ {
@@ -127,6 +199,7 @@ func (route *Route) add(path, method string, handler func(*Context) error) {
 			nextRoute := nowRoute.param
 			if nextRoute == nil {
 				nextRoute = NewRoute(strings.Split(branch, ":")[1])
+				nextRoute.router = nowRoute.router
 				nowRoute.param = nextRoute
 			}
 			nowRoute = nextRoute
@@ -134,12 +207,38 @@ func (route *Route) add(path, method string, handler func(*Context) error) {
 			nextRoute := nowRoute.branches[branch]
 			if nextRoute == nil {
 				nextRoute = NewRoute(branch)
+				nextRoute.router = nowRoute.router
 				nowRoute.branches[branch] = nextRoute
 			}
 			nowRoute = nextRoute
 		}
 	}
 	setMethod(nowRoute, method, route.fullPath+path, handler)
+	return setHandle(nowRoute, method, middlewares)
+}
+
+func setHandle(nowRoute *Route, method string, middlewares []Middleware) *RouteHandle {
+	handle := &RouteHandle{
+		route:       nowRoute,
+		method:      method,
+		middlewares: middlewares,
+	}
+	if nowRoute.handles == nil {
+		nowRoute.handles = make(map[string]*RouteHandle)
+	}
+	switch method {
+	case "STATIC":
+		nowRoute.handles["GET"] = handle
+		break
+	case "MOUNT":
+		for _, m := range []string{"GET", "POST", "PUT", "DELETE"} {
+			nowRoute.handles[m] = handle
+		}
+		break
+	default:
+		nowRoute.handles[method] = handle
+	}
+	return handle
 }
 
 func setMethod(nowRoute *Route, method, fullpath string, handler func(*Context) error) {
@@ -162,22 +261,33 @@ func setMethod(nowRoute *Route, method, fullpath string, handler func(*Context)
 		nowRoute.handlerGET = handler
 		nowRoute.isStatic = true
 		break
+	case "MOUNT":
+		nowRoute.handlerGET = handler
+		nowRoute.handlerPOST = handler
+		nowRoute.handlerPUT = handler
+		nowRoute.handlerDELETE = handler
+		nowRoute.isStatic = true
+		break
 	}
 }
 
 func (route *Route) createRoute(path string) *Route {
 	nowRoute := route
 	branches := strings.Split(path, "/")
+	if len(branches) == 2 && branches[1] == "" {
+		return nowRoute
+	}
 	len := len(branches)
 	for i := 1; i < len; i++ {
 		if nowRoute.isStatic {
 			panic(errStaticRoute)
 		}
 		branch := branches[i]
-		if branch[0] == ':' {
+		if branch != "" && branch[0] == ':' {
 			nextRoute := nowRoute.param
 			if nextRoute == nil {
 				nextRoute = NewRoute(strings.Split(branch, ":")[1])
+				nextRoute.router = nowRoute.router
 				nowRoute.param = nextRoute
 			}
 			nowRoute = nextRoute
@@ -185,6 +295,7 @@ func (route *Route) createRoute(path string) *Route {
 			nextRoute := nowRoute.branches[branch]
 			if nextRoute == nil {
 				nextRoute = NewRoute(branch)
+				nextRoute.router = nowRoute.router
 				nowRoute.branches[branch] = nextRoute
 			}
 			nowRoute = nextRoute
@@ -194,7 +305,7 @@ func (route *Route) createRoute(path string) *Route {
 	return nowRoute
 }
 
-func (route *Route) find(path, method string) (func(*Context) error, []Middleware, map[string]string) {
+func (route *Route) find(path, method string) (func(*Context) error, []Middleware, map[string]string, *Route) {
 	nowRoute := route
 	params := make(map[string]string)
 	middlewares := []Middleware{}
@@ -202,7 +313,7 @@ func (route *Route) find(path, method string) (func(*Context) error, []Middlewar
 	branches := strings.Split(path, "/")
 	len := len(branches)
 	if len == 2 && branches[1] == "" {
-		return getFuncByMethod(nowRoute, method), middlewares, params
+		return getFuncByMethod(nowRoute, method), getMiddlewaresByMethod(nowRoute, method, middlewares), params, nowRoute
 	}
 	for i := 1; i < len; i++ {
 		if nowRoute.isStatic {
@@ -213,14 +324,80 @@ func (route *Route) find(path, method string) (func(*Context) error, []Middlewar
 		if nextRoute == nil {
 			nextRoute = nowRoute.param
 			if nextRoute == nil {
-				return nil, nil, nil
+				return nil, nil, nil, nil
 			}
 			params[nextRoute.path] = branch
 		}
 		nowRoute = nextRoute
 		middlewares = append(middlewares, nowRoute.middlewares...)
 	}
-	return getFuncByMethod(nowRoute, method), middlewares, params
+	return getFuncByMethod(nowRoute, method), getMiddlewaresByMethod(nowRoute, method, middlewares), params, nowRoute
+}
+
+func getMiddlewaresByMethod(nowRoute *Route, method string, middlewares []Middleware) []Middleware {
+	handle := nowRoute.handles[method]
+	if handle == nil {
+		return middlewares
+	}
+	return append(middlewares, handle.middlewares...)
+}
+
+// url function
+// Build path from fullPath, replace :param by value from params
+func (route *Route) url(params Values) (string, error) {
+	if route.fullPath == "" {
+		return "/", nil
+	}
+	branches := strings.Split(route.fullPath, "/")
+	for i, branch := range branches {
+		if branch != "" && branch[0] == ':' {
+			name := branch[1:]
+			value, ok := params[name]
+			if !ok || value == "" {
+				return "", errors.New(errURLParam.Error() + ": " + name)
+			}
+			branches[i] = url.PathEscape(value)
+		}
+	}
+	return strings.Join(branches, "/"), nil
+}
+
+// routes function
+// Collect handlers of route and its children with middlewares of parents
+func (route *Route) routes(middlewares []Middleware, result []RouteInfo) []RouteInfo {
+	middlewares = append(middlewares[:len(middlewares):len(middlewares)], route.middlewares...)
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		handle := route.handles[method]
+		if handle == nil || getFuncByMethod(route, method) == nil {
+			continue
+		}
+		result = append(result, RouteInfo{
+			Method:      method,
+			Path:        route.FullPath(),
+			Name:        handle.name,
+			Permissions: middlewarePermissions(append(middlewares[:len(middlewares):len(middlewares)], handle.middlewares...)),
+		})
+	}
+	branches := make([]string, 0, len(route.branches))
+	for branch := range route.branches {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	for _, branch := range branches {
+		result = route.branches[branch].routes(middlewares, result)
+	}
+	if route.param != nil {
+		result = route.param.routes(middlewares, result)
+	}
+	return result
+}
+
+func middlewarePermissions(middlewares []Middleware) []string {
+	permissions := []string{}
+	for _, middleware := range middlewares {
+		permissions = append(permissions, middleware.permissions...)
+	}
+	return permissions
 }
 
 func getFuncByMethod(nowRoute *Route, method string) func(*Context) error {
@@ -0,0 +1,74 @@
+package magic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	m := NewMagic("0")
+	handler := func(context *Context) error { return nil }
+	m.GET("/", handler).Name("home")
+	m.CreateRoute("/api").GET("/", handler).Name("api")
+	m.GET("/users/:id", handler).Name("user.show")
+	m.CreateRoute("/users/:id").GET("/posts/:post", handler).Name("user.post")
+
+	cases := []struct {
+		name     string
+		params   Values
+		query    ValuesArr
+		expected string
+	}{
+		{"home", nil, nil, "/"},
+		{"api", nil, nil, "/api"},
+		{"user.show", Values{"id": "42"}, nil, "/users/42"},
+		{"user.show", Values{"id": "a b/c?"}, nil, "/users/a%20b%2Fc%3F"},
+		{"user.post", Values{"id": "1", "post": "7"}, nil, "/users/1/posts/7"},
+		{"user.show", Values{"id": "1"}, ValuesArr{"q": {"x y&z"}, "tag": {"a", "b"}}, "/users/1?q=x+y%26z&tag=a&tag=b"},
+		{"home", nil, ValuesArr{"page": {"2"}}, "/?page=2"},
+	}
+	for _, test := range cases {
+		result, err := m.URL(test.name, test.params, test.query)
+		if err != nil || result != test.expected {
+			t.Fatalf("%s %v: expected %q, got %q %v", test.name, test.params, test.expected, result, err)
+		}
+	}
+
+	errorCases := []struct {
+		name   string
+		params Values
+		err    error
+	}{
+		{"user.post", Values{"id": "1"}, errURLParam},
+		{"user.show", Values{"id": ""}, errURLParam},
+		{"missing", nil, errRouteNotFound},
+	}
+	for _, test := range errorCases {
+		_, err := m.URL(test.name, test.params, nil)
+		if err == nil || !strings.HasPrefix(err.Error(), test.err.Error()) {
+			t.Fatalf("%s %v: expected %q, got %v", test.name, test.params, test.err, err)
+		}
+	}
+}
+
+func TestRouteNames(t *testing.T) {
+	m := NewMagic("0")
+	handler := func(context *Context) error { return nil }
+	handle := m.GET("/old", handler).Name("old")
+	handle.Name("renamed")
+	m.GET("/other", handler).Name("old")
+	if result, _ := m.URL("renamed", nil, nil); result != "/old" {
+		t.Fatalf("renamed handler is not found: %q", result)
+	}
+	if result, _ := m.URL("old", nil, nil); result != "/other" {
+		t.Fatalf("old name is not free after rename: %q", result)
+	}
+
+	defer func() {
+		recovered, _ := recover().(string)
+		if !strings.HasPrefix(recovered, errRouteName.Error()) {
+			t.Fatalf("expected panic on duplicate name, got %v", recovered)
+		}
+	}()
+	m.GET("/duplicate", handler).Name("renamed")
+}
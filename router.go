@@ -1,15 +1,23 @@
 package magic
 
 import (
+	"errors"
 	"io/ioutil"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 // Router structure
 type Router struct {
-	mainRoute *Route
+	mainRoute      *Route
+	names          map[string]*RouteHandle
+	middlewares    []Middleware
+	preMiddlewares []Middleware
+	cookieConfig   CookieConfig
+	trustedProxies []*net.IPNet
 }
 
 // NewRouter function
@@ -23,61 +31,152 @@ func NewRouter() *Router {
 		},
 	}
 	router.mainRoute.branches = make(map[string]*Route)
+	router.mainRoute.router = router
+	router.names = make(map[string]*RouteHandle)
+	router.cookieConfig = DefaultCookieConfig()
 	return router
 }
 
 // Handle interface
 func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	handler, middlewares, params := router.mainRoute.find(r.URL.Path, r.Method)
 	context := getContext(w, r)
-	if handler != nil {
+	context.router = router
+	startHandler(context, router.preMiddlewares, router.handle)
+}
 
-		context.Params = params
-		queryParams, err := url.ParseQuery(r.URL.RawQuery)
-		if err == nil {
-			context.QueryParams = map[string][]string(queryParams)
-		}
+func (router *Router) handle(context *Context) error {
+	r := context.Request
+	handler, middlewares, params, route := router.mainRoute.find(r.URL.Path, r.Method)
+	if handler == nil {
+		handler = notFoundHandler
+	} else {
+		context.Route = route
+	}
 
-		err = r.ParseForm()
-		if err == nil {
-			postParams := map[string][]string(r.PostForm)
-			context.PostParams = postParams
-		}
+	context.Params = params
+	queryParams, err := url.ParseQuery(r.URL.RawQuery)
+	if err == nil {
+		context.QueryParams = map[string][]string(queryParams)
+	}
 
-		err = r.ParseMultipartForm(MaxBytes)
-		if err == nil {
-			multipartParams := map[string][]string(r.MultipartForm.Value)
-			context.MultipartParams = multipartParams
-			files := map[string][]*multipart.FileHeader(r.MultipartForm.File)
-			context.FileParams = files
-		}
+	err = r.ParseForm()
+	if err == nil {
+		postParams := map[string][]string(r.PostForm)
+		context.PostParams = postParams
+	}
+
+	err = r.ParseMultipartForm(MaxBytes)
+	if err == nil {
+		multipartParams := map[string][]string(r.MultipartForm.Value)
+		context.MultipartParams = multipartParams
+		files := map[string][]*multipart.FileHeader(r.MultipartForm.File)
+		context.FileParams = files
+	}
 
-		headers := map[string][]string(r.Header)
+	headers := map[string][]string(r.Header)
 
-		context.Headers = headers
+	context.Headers = headers
 
-		bytes, _ := ioutil.ReadAll(r.Body)
-		defer r.Body.Close()
-		context.Body = string(bytes)
+	bytes, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	context.Body = string(bytes)
 
-		startHandler(context, middlewares, handler)
-	} else {
-		context.SendErrorString("page not found")
-	}
+	allMiddlewares := []Middleware{}
+	allMiddlewares = append(allMiddlewares, router.middlewares...)
+	allMiddlewares = append(allMiddlewares, middlewares...)
+	return chainHandler(allMiddlewares, handler)(context)
 }
 
-func startHandler(context *Context, middlewares []Middleware, handler func(context *Context) error) {
+// Use function
+// Add middlewares which run for every request, also if route not found
+// Middlewares run in order: global -> parent route -> child route -> handler
+func (router *Router) Use(middlewares ...Middleware) {
+	router.middlewares = append(router.middlewares, middlewares...)
+}
 
-	for _, middleware := range middlewares {
-		err := middleware.run(context)
+// Pre function
+// Add middlewares which run before routing
+// They can change context.Request.Method or context.Request.URL.Path
+func (router *Router) Pre(middlewares ...Middleware) {
+	router.preMiddlewares = append(router.preMiddlewares, middlewares...)
+}
+
+// SetCookieConfig function
+// Set defaults and keys of cookies for context.SetCookie, context.SetSignedCookie, ...
+// Panic if encryption key is not 16, 24 or 32 bytes
+func (router *Router) SetCookieConfig(config CookieConfig) {
+	for _, key := range config.EncryptionKeys {
+		if _, err := cookieAEAD(key); err != nil {
+			panic(err)
+		}
+	}
+	router.cookieConfig = config
+}
+
+// SetTrustedProxies function
+// Set proxies like "10.0.0.0/8" or "127.0.0.1" whose X-Forwarded-For and X-Real-IP are used by context.RealIP
+// Panic if proxy is not ip or CIDR
+func (router *Router) SetTrustedProxies(proxies ...string) {
+	trustedProxies := []*net.IPNet{}
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
 		if err != nil {
-			return
+			panic(errTrustedProxy.Error() + ": " + proxy)
 		}
+		trustedProxies = append(trustedProxies, network)
 	}
+	router.trustedProxies = trustedProxies
+}
+
+func (router *Router) isTrustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range router.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
 
-	err := handler(context)
+// URL function
+// Build url by name of handler
+// Return error if name not found or param missing
+func (router *Router) URL(name string, params Values, query ValuesArr) (string, error) {
+	handle := router.names[name]
+	if handle == nil {
+		return "", errors.New(errRouteNotFound.Error() + ": " + name)
+	}
+	path, err := handle.route.url(params)
 	if err != nil {
-		return
+		return "", err
+	}
+	if len(query) != 0 {
+		path += "?" + url.Values(query).Encode()
 	}
+	return path, nil
+}
+
+// Routes function
+// Return all handlers with their paths, names and required permissions
+func (router *Router) Routes() []RouteInfo {
+	return router.mainRoute.routes(router.middlewares, []RouteInfo{})
+}
+
+func notFoundHandler(context *Context) error {
+	context.Writer.WriteHeader(http.StatusNotFound)
+	return context.SendErrorString("page not found")
+}
 
+func startHandler(context *Context, middlewares []Middleware, handler func(context *Context) error) {
+	chainHandler(middlewares, handler)(context)
 }
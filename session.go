@@ -0,0 +1,530 @@
+package magic
+
+import (
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errSessionKeys     = errors.New("session needs hash keys")
+	errSessionTooLarge = errors.New("session is too large for cookie")
+)
+
+const sessionKey = "magic.session"
+
+// maxCookieSize - browsers keep cookies up to 4096 bytes
+const maxCookieSize = 4096
+
+// SessionConfig structure
+// CookieName - name of session cookie (default "session")
+// HashKeys - keys for HMAC of cookie, first key signs, all keys verify (for rotation), required
+// EncryptionKeys - AES keys (16, 24 or 32 bytes) which encrypt session data in cookie, first key encrypts, all keys decrypt
+// Store - server-side store like NewMemorySessionStore(), if nil session data is stored in cookie
+// IdleTimeout - session expires if there are no requests for this time (default 30 minutes)
+// AbsoluteTimeout - session expires after this time from creation (default 24 hours)
+// Path, Domain, SameSite - attributes of cookie, if empty they are taken from magic.SetCookieConfig (default path "/" and SameSite Lax)
+// Secure - cookie is Secure if it is true or Secure of magic.SetCookieConfig is true (it is true by default)
+// Cookie is always HttpOnly
+type SessionConfig struct {
+	CookieName      string
+	HashKeys        [][]byte
+	EncryptionKeys  [][]byte
+	Store           SessionStore
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+	Path            string
+	Domain          string
+	Secure          bool
+	SameSite        http.SameSite
+}
+
+// SessionStore interface
+// Server-side store of encoded sessions, implement it to use Redis or other storage
+// Get returns nil without error if session not found or expired
+type SessionStore interface {
+	Get(id string) ([]byte, error)
+	Set(id string, data []byte, expiresAt time.Time) error
+	Delete(id string) error
+}
+
+// Session structure
+// Values are stored as JSON, so numbers are float64 after next request
+type Session struct {
+	state     sessionState
+	isNew     bool
+	changed   bool
+	destroyed bool
+	oldIDs    []string
+}
+
+type sessionState struct {
+	ID      string                 `json:"id"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+	Flashes []string               `json:"flashes,omitempty"`
+	Created int64                  `json:"created"`
+	Seen    int64                  `json:"seen"`
+}
+
+// NewSessionMiddleware function
+// Create new session middleware, get session by context.Session()
+// Session is saved before response is sent, new session without values doesn't set cookie
+// Error of saving is returned by middleware if handler sent nothing, else it is logged
+func NewSessionMiddleware(config SessionConfig) Middleware {
+	if len(config.HashKeys) == 0 {
+		panic(errSessionKeys)
+	}
+	for _, key := range config.EncryptionKeys {
+		if _, err := aes.NewCipher(key); err != nil {
+			panic(err)
+		}
+	}
+	if config.CookieName == "" {
+		config.CookieName = "session"
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 30 * time.Minute
+	}
+	if config.AbsoluteTimeout == 0 {
+		config.AbsoluteTimeout = 24 * time.Hour
+	}
+	return NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) error {
+			session, err := loadSession(context, config, time.Now())
+			if err != nil {
+				context.Writer.WriteHeader(http.StatusInternalServerError)
+				return context.SendError(err)
+			}
+			context.Storage[sessionKey] = session
+			saved := false
+			context.Response.Before(func() {
+				if saved {
+					return
+				}
+				saved = true
+				if err := saveSession(context, session, config, time.Now()); err != nil {
+					log.Printf("session is not saved: request_id=%s: %v", context.RequestID, err)
+				}
+			})
+			err = next(context)
+			if !saved && !context.Response.Written() {
+				saved = true
+				if saveErr := saveSession(context, session, config, time.Now()); saveErr != nil && err == nil {
+					return saveErr
+				}
+			}
+			return err
+		}
+	})
+}
+
+// Session function
+// Return session of request, nil if there is no session middleware
+func (context *Context) Session() *Session {
+	session, _ := context.Storage[sessionKey].(*Session)
+	return session
+}
+
+func newSession(now time.Time) *Session {
+	return &Session{
+		state: sessionState{
+			ID:      randomID(),
+			Values:  make(map[string]interface{}),
+			Created: now.Unix(),
+			Seen:    now.Unix(),
+		},
+		isNew: true,
+	}
+}
+
+func loadSession(context *Context, config SessionConfig, now time.Time) (*Session, error) {
+	cookie, err := context.Request.Cookie(config.CookieName)
+	if err != nil {
+		return newSession(now), nil
+	}
+	value, err := verifyCookieValue(config.HashKeys, config.CookieName, cookie.Value)
+	if err != nil {
+		return newSession(now), nil
+	}
+	var data []byte
+	switch {
+	case config.Store != nil:
+		data, err = config.Store.Get(value)
+		if err != nil {
+			return nil, err
+		}
+	case len(config.EncryptionKeys) != 0:
+		data, _ = decryptCookieValue(config.EncryptionKeys, config.CookieName, value)
+	default:
+		data, _ = base64.RawURLEncoding.DecodeString(value)
+	}
+	session := &Session{}
+	if data == nil || json.Unmarshal(data, &session.state) != nil {
+		return newSession(now), nil
+	}
+	if config.Store != nil && session.state.ID != value {
+		return newSession(now), nil
+	}
+	if now.Sub(time.Unix(session.state.Seen, 0)) > config.IdleTimeout ||
+		now.Sub(time.Unix(session.state.Created, 0)) > config.AbsoluteTimeout {
+		if config.Store != nil {
+			if err := config.Store.Delete(value); err != nil {
+				return nil, err
+			}
+		}
+		session = newSession(now)
+		session.oldIDs = []string{value}
+		return session, nil
+	}
+	if session.state.Values == nil {
+		session.state.Values = make(map[string]interface{})
+	}
+	return session, nil
+}
+
+func saveSession(context *Context, session *Session, config SessionConfig, now time.Time) error {
+	cookieConfig := context.cookieConfig()
+	cookie := &http.Cookie{
+		Name:     config.CookieName,
+		Path:     cookieConfig.Path,
+		Domain:   cookieConfig.Domain,
+		Secure:   cookieConfig.Secure || config.Secure,
+		HttpOnly: true,
+		SameSite: cookieConfig.SameSite,
+	}
+	if config.Path != "" {
+		cookie.Path = config.Path
+	}
+	if config.Domain != "" {
+		cookie.Domain = config.Domain
+	}
+	if config.SameSite != 0 {
+		cookie.SameSite = config.SameSite
+	}
+	if config.Store != nil {
+		for _, id := range session.oldIDs {
+			if err := config.Store.Delete(id); err != nil {
+				return err
+			}
+		}
+	}
+	if session.destroyed {
+		if config.Store != nil {
+			if err := config.Store.Delete(session.state.ID); err != nil {
+				return err
+			}
+		}
+		if !session.isNew || len(session.oldIDs) != 0 {
+			cookie.MaxAge = -1
+			http.SetCookie(context.Response, cookie)
+		}
+		return nil
+	}
+	if session.isNew && !session.changed {
+		return nil
+	}
+
+	session.state.Seen = now.Unix()
+	created := time.Unix(session.state.Created, 0)
+	expiresAt := now.Add(config.IdleTimeout)
+	if created.Add(config.AbsoluteTimeout).Before(expiresAt) {
+		expiresAt = created.Add(config.AbsoluteTimeout)
+	}
+	data, err := json.Marshal(session.state)
+	if err != nil {
+		return err
+	}
+
+	var value string
+	switch {
+	case config.Store != nil:
+		if err := config.Store.Set(session.state.ID, data, expiresAt); err != nil {
+			return err
+		}
+		value = session.state.ID
+	case len(config.EncryptionKeys) != 0:
+		value, err = encryptCookieValue(config.EncryptionKeys, config.CookieName, data)
+		if err != nil {
+			return err
+		}
+	default:
+		value = base64.RawURLEncoding.EncodeToString(data)
+	}
+	cookie.Value = signCookieValue(config.HashKeys, config.CookieName, value)
+	cookie.Expires = created.Add(config.AbsoluteTimeout)
+	if len(cookie.String()) > maxCookieSize {
+		return errSessionTooLarge
+	}
+	http.SetCookie(context.Response, cookie)
+	return nil
+}
+
+// ID function
+// Return id of session
+func (session *Session) ID() string {
+	return session.state.ID
+}
+
+// IsNew function
+// Return true if session is created by this request
+func (session *Session) IsNew() bool {
+	return session.isNew
+}
+
+// Get function
+// Return value of key, nil if there is no key
+func (session *Session) Get(key string) interface{} {
+	return session.state.Values[key]
+}
+
+// Set function
+// Set value of key, value must be encodable to JSON
+// Session is saved when response is sent, so Set can't return errors of saving
+// (cookie over 4096 bytes or error of SessionStore), they are logged and changes are lost
+func (session *Session) Set(key string, value interface{}) {
+	session.state.Values[key] = value
+	session.changed = true
+}
+
+// Delete function
+// Delete key from session
+func (session *Session) Delete(key string) {
+	delete(session.state.Values, key)
+	session.changed = true
+}
+
+// AddFlash function
+// Add message which is returned by Flashes in next request
+func (session *Session) AddFlash(message string) {
+	session.state.Flashes = append(session.state.Flashes, message)
+	session.changed = true
+}
+
+// Flashes function
+// Return flash messages and delete them from session
+func (session *Session) Flashes() []string {
+	flashes := session.state.Flashes
+	if len(flashes) != 0 {
+		session.state.Flashes = nil
+		session.changed = true
+	}
+	return flashes
+}
+
+// RotateID function
+// Change id of session and keep values, call it after login
+func (session *Session) RotateID() {
+	session.oldIDs = append(session.oldIDs, session.state.ID)
+	session.state.ID = randomID()
+	session.changed = true
+}
+
+// Destroy function
+// Delete session and its cookie, call it on logout
+func (session *Session) Destroy() {
+	session.state.Values = make(map[string]interface{})
+	session.state.Flashes = nil
+	session.destroyed = true
+}
+
+// MemorySessionStore structure
+// SessionStore which keeps sessions in memory of process
+type MemorySessionStore struct {
+	mutex       sync.Mutex
+	sessions    map[string]memorySession
+	lastCleanup time.Time
+}
+
+type memorySession struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewMemorySessionStore function
+// Create new MemorySessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:    make(map[string]memorySession),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Get function
+// Return data of session, nil if session not found or expired
+func (store *MemorySessionStore) Get(id string) ([]byte, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	session, ok := store.sessions[id]
+	if !ok || time.Now().After(session.expiresAt) {
+		return nil, nil
+	}
+	return session.data, nil
+}
+
+// Set function
+// Save data of session until expiresAt
+func (store *MemorySessionStore) Set(id string, data []byte, expiresAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(store.lastCleanup) > time.Minute {
+		store.lastCleanup = now
+		for key, session := range store.sessions {
+			if now.After(session.expiresAt) {
+				delete(store.sessions, key)
+			}
+		}
+	}
+	store.sessions[id] = memorySession{
+		data:      data,
+		expiresAt: expiresAt,
+	}
+	return nil
+}
+
+// Delete function
+// Delete session
+func (store *MemorySessionStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.sessions, id)
+	return nil
+}
+
+// FileSessionStore structure
+// SessionStore which keeps every session in file of directory
+type FileSessionStore struct {
+	dir         string
+	mutex       sync.Mutex
+	lastCleanup time.Time
+}
+
+// NewFileSessionStore function
+// Create new FileSessionStore, directory is created if it doesn't exist
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{
+		dir:         dir,
+		lastCleanup: time.Now(),
+	}, nil
+}
+
+// Get function
+// Return data of session, nil if session not found or expired
+func (store *FileSessionStore) Get(id string) ([]byte, error) {
+	fileName, ok := store.fileName(id)
+	if !ok {
+		return nil, nil
+	}
+	bytes, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	expiresAt, data, ok := parseSessionFile(bytes)
+	if !ok || time.Now().After(expiresAt) {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// Set function
+// Save data of session until expiresAt
+// File is replaced atomically, so reader never gets partially written session
+func (store *FileSessionStore) Set(id string, data []byte, expiresAt time.Time) error {
+	fileName, ok := store.fileName(id)
+	if !ok {
+		return errCookieValue
+	}
+	store.cleanup()
+	file, err := os.CreateTemp(store.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(strconv.FormatInt(expiresAt.Unix(), 10) + "\n")
+	if err == nil {
+		_, err = file.Write(data)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// Delete function
+// Delete file of session
+func (store *FileSessionStore) Delete(id string) error {
+	fileName, ok := store.fileName(id)
+	if !ok {
+		return nil
+	}
+	err := os.Remove(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// fileName function
+// Return file of session, id must contain only hex symbols so it can't leave directory
+func (store *FileSessionStore) fileName(id string) (string, bool) {
+	if id == "" || strings.Trim(id, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return filepath.Join(store.dir, "session-"+id), true
+}
+
+// cleanup function
+// Delete expired sessions once per minute
+func (store *FileSessionStore) cleanup() {
+	store.mutex.Lock()
+	now := time.Now()
+	if now.Sub(store.lastCleanup) <= time.Minute {
+		store.mutex.Unlock()
+		return
+	}
+	store.lastCleanup = now
+	store.mutex.Unlock()
+	fileNames, _ := filepath.Glob(filepath.Join(store.dir, "session-*"))
+	for _, fileName := range fileNames {
+		bytes, err := os.ReadFile(fileName)
+		if err != nil {
+			continue
+		}
+		expiresAt, _, ok := parseSessionFile(bytes)
+		if !ok || now.After(expiresAt) {
+			os.Remove(fileName)
+		}
+	}
+}
+
+func parseSessionFile(bytes []byte) (time.Time, []byte, bool) {
+	index := strings.IndexByte(string(bytes), '\n')
+	if index < 0 {
+		return time.Time{}, nil, false
+	}
+	expires, err := strconv.ParseInt(string(bytes[:index]), 10, 64)
+	if err != nil {
+		return time.Time{}, nil, false
+	}
+	return time.Unix(expires, 0), bytes[index+1:], true
+}
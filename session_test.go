@@ -0,0 +1,110 @@
+package magic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newSessionTestRouter(config SessionConfig) *Router {
+	router := NewRouter()
+	router.Use(NewSessionMiddleware(config))
+	router.mainRoute.POST("/login", func(context *Context) error {
+		context.Session().RotateID()
+		context.Session().Set("user", "bob")
+		context.Session().AddFlash("welcome")
+		return context.SendString("ok")
+	})
+	router.mainRoute.GET("/me", func(context *Context) error {
+		user, _ := context.Session().Get("user").(string)
+		return context.SendString(user + "|" + strings.Join(context.Session().Flashes(), ","))
+	})
+	return router
+}
+
+func serveSession(router *Router, method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestSessionStores(t *testing.T) {
+	fileStore, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashKeys := [][]byte{[]byte("hash key")}
+	cases := map[string]SessionConfig{
+		"signed cookie":    {HashKeys: hashKeys},
+		"encrypted cookie": {HashKeys: hashKeys, EncryptionKeys: [][]byte{[]byte("0123456789abcdef")}},
+		"memory store":     {HashKeys: hashKeys, Store: NewMemorySessionStore()},
+		"file store":       {HashKeys: hashKeys, Store: fileStore},
+	}
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			router := newSessionTestRouter(config)
+			if cookies := serveSession(router, "GET", "/me", nil).Result().Cookies(); len(cookies) != 0 {
+				t.Fatal("empty session sets cookie")
+			}
+			cookie := serveSession(router, "POST", "/login", nil).Result().Cookies()[0]
+			recorder := serveSession(router, "GET", "/me", cookie)
+			if body := recorder.Body.String(); body != "bob|welcome" {
+				t.Fatalf("expected user and flash, got %q", body)
+			}
+			cookie = recorder.Result().Cookies()[0]
+			if body := serveSession(router, "GET", "/me", cookie).Body.String(); body != "bob|" {
+				t.Fatalf("expected flash to be read once, got %q", body)
+			}
+			cookie.Value = "x" + cookie.Value
+			if body := serveSession(router, "GET", "/me", cookie).Body.String(); body != "|" {
+				t.Fatalf("changed cookie is accepted, got %q", body)
+			}
+		})
+	}
+}
+
+func TestSessionCookieDefaults(t *testing.T) {
+	router := newSessionTestRouter(SessionConfig{HashKeys: [][]byte{[]byte("k")}})
+	cookie := serveSession(router, "POST", "/login", nil).Result().Cookies()[0]
+	if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Fatalf("session cookie doesn't use secure defaults: %+v", cookie)
+	}
+
+	config := DefaultCookieConfig()
+	config.Secure = false
+	config.Domain = "example.com"
+	router = newSessionTestRouter(SessionConfig{HashKeys: [][]byte{[]byte("k")}, Path: "/app", SameSite: http.SameSiteStrictMode})
+	router.SetCookieConfig(config)
+	cookie = serveSession(router, "POST", "/login", nil).Result().Cookies()[0]
+	if cookie.Secure || cookie.Domain != "example.com" || cookie.Path != "/app" || cookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("session cookie doesn't use instance config and overrides: %+v", cookie)
+	}
+}
+
+func TestSessionSaveError(t *testing.T) {
+	var handlerErr error
+	router := NewRouter()
+	router.Use(NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) error {
+			handlerErr = next(context)
+			return handlerErr
+		}
+	}))
+	router.Use(NewSessionMiddleware(SessionConfig{HashKeys: [][]byte{[]byte("k")}}))
+	router.mainRoute.POST("/big", func(context *Context) error {
+		context.Session().Set("data", strings.Repeat("a", maxCookieSize))
+		return nil
+	})
+	recorder := serveSession(router, "POST", "/big", nil)
+	if handlerErr != errSessionTooLarge {
+		t.Fatalf("expected %q, got %v", errSessionTooLarge, handlerErr)
+	}
+	if len(recorder.Result().Cookies()) != 0 {
+		t.Fatal("too large session sets cookie")
+	}
+}
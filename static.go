@@ -0,0 +1,341 @@
+package magic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticConfig structure
+// Index - file which is sent for directory (default "index.html")
+// Browse - show list of files for directory without index file
+// AllowHidden - allow files and directories which start with "."
+// CacheControl - Cache-Control header by file pattern, first matched rule is used
+// ETag - send ETag computed from content of file, it is computed once and cached
+// Precompressed - send "file.br" or "file.gz" instead of "file" if client accepts it
+// SPA - send Fallback for missing paths without extension like "/settings/profile"
+// Missing files with extension like "/app.js" still get 404
+// Fallback - file for SPA (default "/" + Index)
+type StaticConfig struct {
+	Index         string
+	Browse        bool
+	AllowHidden   bool
+	CacheControl  []StaticCacheRule
+	ETag          bool
+	Precompressed bool
+	SPA           bool
+	Fallback      string
+}
+
+// StaticCacheRule structure
+// Pattern - pattern for path.Match like "*.html" or "/assets/*"
+// Pattern without "/" is matched with name of file, else with full path of file
+// Value - value of Cache-Control header like "public, max-age=31536000, immutable"
+type StaticCacheRule struct {
+	Pattern string
+	Value   string
+}
+
+type staticServer struct {
+	fileSystem http.FileSystem
+	config     StaticConfig
+	prefix     string
+	etags      sync.Map
+}
+
+type staticETag struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+// staticEncodings - encodings of precompressed files in order of preference
+var staticEncodings = []string{"br", "gzip"}
+
+var staticExtensions = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// STATICFS function
+// Add static route for fs.FS like embed.FS
+// Full path must't contain params like "/a/:id/static"
+func (route *Route) STATICFS(path string, fileSystem fs.FS, config StaticConfig, middlewares ...Middleware) *RouteHandle {
+	return route.STATICFileSystem(path, http.FS(fileSystem), config, middlewares...)
+}
+
+// STATICFileSystem function
+// Add static route for http.FileSystem like http.Dir("./public")
+// Full path must't contain params like "/a/:id/static"
+func (route *Route) STATICFileSystem(path string, fileSystem http.FileSystem, config StaticConfig, middlewares ...Middleware) *RouteHandle {
+	if strings.Contains(route.fullPath+path, ":") {
+		panic(errStaticRouteParams.Error() + ": " + route.fullPath + path)
+	}
+	server := &staticServer{
+		fileSystem: fileSystem,
+		config:     staticDefaults(config),
+		prefix:     route.fullPath + path,
+	}
+	handle := route.add(path, "STATIC", server.serve, middlewares...)
+	handle.static = server
+	return handle
+}
+
+// Static function
+// Set options of static route added by STATIC, STATICFS or STATICFileSystem
+// Like magic.STATIC("/app", "./dist").Static(StaticConfig{SPA: true, ETag: true})
+// Config replaces options of route, also Browse: true of STATIC, so directories are not listed unless Browse is set
+// Panic if handler is not static
+func (handle *RouteHandle) Static(config StaticConfig) *RouteHandle {
+	if handle.static == nil {
+		panic(errStaticHandle)
+	}
+	handle.static.config = staticDefaults(config)
+	return handle
+}
+
+func staticDefaults(config StaticConfig) StaticConfig {
+	checkCacheRules(config.CacheControl)
+	if config.Index == "" {
+		config.Index = "index.html"
+	}
+	if config.Fallback == "" {
+		config.Fallback = "/" + config.Index
+	}
+	return config
+}
+
+// STATICFS function
+// Add static route for fs.FS like embed.FS
+func (magic *Magic) STATICFS(path string, fileSystem fs.FS, config StaticConfig, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.STATICFS(path, fileSystem, config, middlewares...)
+}
+
+// STATICFileSystem function
+// Add static route for http.FileSystem
+func (magic *Magic) STATICFileSystem(path string, fileSystem http.FileSystem, config StaticConfig, middlewares ...Middleware) *RouteHandle {
+	return magic.router.mainRoute.STATICFileSystem(path, fileSystem, config, middlewares...)
+}
+
+func (server *staticServer) serve(context *Context) error {
+	fileName, ok := server.fileName(context.Request.URL.Path)
+	if !ok {
+		context.Writer.WriteHeader(http.StatusBadRequest)
+		return context.SendErrorString("invalid path")
+	}
+	if !server.config.AllowHidden && hiddenPath(fileName) {
+		return notFoundHandler(context)
+	}
+
+	file, err := server.fileSystem.Open(fileName)
+	if err != nil {
+		if server.config.SPA && path.Ext(fileName) == "" {
+			return server.serveFallback(context)
+		}
+		return notFoundHandler(context)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return notFoundHandler(context)
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(context.Request.URL.Path, "/") {
+			http.Redirect(context.Writer, context.Request, path.Base(context.Request.URL.Path)+"/", http.StatusMovedPermanently)
+			return nil
+		}
+		indexName := path.Join(fileName, server.config.Index)
+		index, err := server.fileSystem.Open(indexName)
+		if err == nil {
+			defer index.Close()
+			indexInfo, err := index.Stat()
+			if err == nil && !indexInfo.IsDir() {
+				return server.serveFile(context, indexName, index, indexInfo)
+			}
+		}
+		if !server.config.Browse {
+			return notFoundHandler(context)
+		}
+		return server.browse(context, file)
+	}
+
+	return server.serveFile(context, fileName, file, info)
+}
+
+func (server *staticServer) serveFallback(context *Context) error {
+	file, err := server.fileSystem.Open(server.config.Fallback)
+	if err != nil {
+		return notFoundHandler(context)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return notFoundHandler(context)
+	}
+	return server.serveFile(context, server.config.Fallback, file, info)
+}
+
+func (server *staticServer) serveFile(context *Context, fileName string, file http.File, info fs.FileInfo) error {
+	header := context.Writer.Header()
+	if value := server.cacheControl(fileName); value != "" {
+		header.Set("Cache-Control", value)
+	}
+
+	if server.config.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		contentType := mime.TypeByExtension(path.Ext(fileName))
+		if contentType != "" {
+			encodings := append([]string{}, staticEncodings...)
+			// try variants by q value of Accept-Encoding, skip missed files
+			for {
+				encoding := negotiateEncoding(context.Request.Header.Get("Accept-Encoding"), encodings)
+				if encoding == "" {
+					break
+				}
+				encodings = removeString(encodings, encoding)
+				compressedName := fileName + staticExtensions[encoding]
+				compressed, err := server.fileSystem.Open(compressedName)
+				if err != nil {
+					continue
+				}
+				defer compressed.Close()
+				compressedInfo, err := compressed.Stat()
+				if err != nil || compressedInfo.IsDir() {
+					continue
+				}
+				header.Set("Content-Type", contentType)
+				header.Set("Content-Encoding", encoding)
+				file, info, fileName = compressed, compressedInfo, compressedName
+				break
+			}
+		}
+	}
+
+	if server.config.ETag {
+		etag, err := server.etag(fileName, file, info)
+		if err == nil {
+			header.Set("ETag", etag)
+		}
+	}
+
+	http.ServeContent(context.Writer, context.Request, info.Name(), info.ModTime(), file)
+	return nil
+}
+
+func (server *staticServer) cacheControl(fileName string) string {
+	for _, rule := range server.config.CacheControl {
+		name := path.Base(fileName)
+		if strings.Contains(rule.Pattern, "/") {
+			name = fileName
+		}
+		if matched, _ := path.Match(rule.Pattern, name); matched {
+			return rule.Value
+		}
+	}
+	return ""
+}
+
+func checkCacheRules(rules []StaticCacheRule) {
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			panic(err.Error() + ": " + rule.Pattern)
+		}
+	}
+}
+
+// etag function
+// Return cached ETag of file, compute it if file changed
+func (server *staticServer) etag(fileName string, file http.File, info fs.FileInfo) (string, error) {
+	if cached, ok := server.etags.Load(fileName); ok {
+		etag := cached.(staticETag)
+		if etag.modTime.Equal(info.ModTime()) && etag.size == info.Size() {
+			return etag.value, nil
+		}
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	value := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	server.etags.Store(fileName, staticETag{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		value:   value,
+	})
+	return value, nil
+}
+
+// fileName function
+// Return cleaned name of file from url path, false if path tries to leave root
+func (server *staticServer) fileName(urlPath string) (string, bool) {
+	name := strings.TrimPrefix(urlPath, server.prefix)
+	if strings.ContainsRune(name, 0) || strings.Contains(name, "\\") {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	return path.Clean("/" + name), true
+}
+
+func (server *staticServer) browse(context *Context, dir http.File) error {
+	files, err := dir.Readdir(-1)
+	if err != nil {
+		context.Writer.WriteHeader(http.StatusInternalServerError)
+		return context.SendErrorString("can't read directory")
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+	context.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintln(context.Writer, "<pre>")
+	for _, file := range files {
+		name := file.Name()
+		if !server.config.AllowHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if file.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(context.Writer, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(name))
+	}
+	fmt.Fprintln(context.Writer, "</pre>")
+	return nil
+}
+
+func removeString(values []string, value string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func hiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package magic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// writeStaticFiles function
+// Create files with content in dir, names are like "assets/app.js"
+func writeStaticFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func serveStatic(m *Magic, path, acceptEncoding string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", path, nil)
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	recorder := httptest.NewRecorder()
+	m.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestSTATICWithConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeStaticFiles(t, dir, map[string]string{
+		"index.html":          "<html>app</html>",
+		"assets/app.1234.js":  "console.log('app')",
+		"assets/app.1234.css": "body {}",
+	})
+
+	m := NewMagic("0")
+	m.STATIC("/plain", dir)
+	m.STATIC("/app", dir).Static(StaticConfig{
+		SPA:  true,
+		ETag: true,
+		CacheControl: []StaticCacheRule{
+			{Pattern: "/assets/*", Value: "public, max-age=31536000, immutable"},
+			{Pattern: "*.html", Value: "no-cache"},
+		},
+	})
+
+	cases := []struct {
+		path         string
+		code         int
+		body         string
+		cacheControl string
+	}{
+		{"/plain/assets/app.1234.js", http.StatusOK, "console.log('app')", ""},
+		{"/plain/settings/profile", http.StatusNotFound, "", ""},
+		{"/app/assets/app.1234.js", http.StatusOK, "console.log('app')", "public, max-age=31536000, immutable"},
+		{"/app/settings/profile", http.StatusOK, "<html>app</html>", "no-cache"},
+		{"/app/assets/missing.js", http.StatusNotFound, "", ""},
+	}
+	for _, test := range cases {
+		recorder := httptest.NewRecorder()
+		m.router.ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil))
+		if recorder.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.code, recorder.Code)
+		}
+		if test.body != "" && recorder.Body.String() != test.body {
+			t.Fatalf("%s: expected %q, got %q", test.path, test.body, recorder.Body.String())
+		}
+		if recorder.Header().Get("Cache-Control") != test.cacheControl {
+			t.Fatalf("%s: expected Cache-Control %q, got %q", test.path, test.cacheControl, recorder.Header().Get("Cache-Control"))
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	m.router.ServeHTTP(recorder, httptest.NewRequest("GET", "/app/assets/app.1234.css", nil))
+	etag := recorder.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("ETag is missed")
+	}
+	request := httptest.NewRequest("GET", "/app/assets/app.1234.css", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	m.router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", recorder.Code)
+	}
+}
+
+func TestStaticOnNotStaticHandlePanics(t *testing.T) {
+	defer func() {
+		if recover() != errStaticHandle {
+			t.Fatal("expected panic for not static handler")
+		}
+	}()
+	NewMagic("0").GET("/", func(context *Context) error { return nil }).Static(StaticConfig{})
+}
+
+func TestStaticReplacesBrowse(t *testing.T) {
+	dir := t.TempDir()
+	writeStaticFiles(t, dir, map[string]string{"sub/file.txt": "file"})
+	m := NewMagic("0")
+	m.STATIC("/default", dir)
+	m.STATIC("/etag", dir).Static(StaticConfig{ETag: true})
+	m.STATIC("/browse", dir).Static(StaticConfig{ETag: true, Browse: true})
+
+	if recorder := serveStatic(m, "/default/sub/", ""); !strings.Contains(recorder.Body.String(), "file.txt") {
+		t.Fatalf("STATIC doesn't list directory: %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serveStatic(m, "/etag/sub/", ""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("Static without Browse lists directory: %d", recorder.Code)
+	}
+	if recorder := serveStatic(m, "/browse/sub/", ""); !strings.Contains(recorder.Body.String(), "file.txt") {
+		t.Fatalf("Static with Browse doesn't list directory: %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	dir := t.TempDir()
+	writeStaticFiles(t, dir, map[string]string{
+		"app.js":    "plain",
+		"app.js.br": "brotli",
+		"app.js.gz": "gzip",
+		"style.css": "plain css",
+	})
+	m := NewMagic("0")
+	m.STATIC("/s", dir).Static(StaticConfig{Precompressed: true})
+
+	cases := []struct {
+		path           string
+		acceptEncoding string
+		body           string
+		encoding       string
+	}{
+		{"/s/app.js", "gzip, br", "brotli", "br"},
+		{"/s/app.js", "br;q=0.5, gzip", "gzip", "gzip"},
+		{"/s/app.js", "gzip", "gzip", "gzip"},
+		{"/s/app.js", "deflate", "plain", ""},
+		{"/s/app.js", "", "plain", ""},
+		{"/s/style.css", "gzip, br", "plain css", ""},
+	}
+	for _, test := range cases {
+		recorder := serveStatic(m, test.path, test.acceptEncoding)
+		if recorder.Body.String() != test.body || recorder.Header().Get("Content-Encoding") != test.encoding {
+			t.Fatalf("%s %q: expected %q with %q, got %q with %q", test.path, test.acceptEncoding,
+				test.body, test.encoding, recorder.Body.String(), recorder.Header().Get("Content-Encoding"))
+		}
+		if recorder.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s %q: Vary is missed", test.path, test.acceptEncoding)
+		}
+		if test.path == "/s/app.js" && !strings.Contains(recorder.Header().Get("Content-Type"), "javascript") {
+			t.Fatalf("%s %q: wrong Content-Type %q", test.path, test.acceptEncoding, recorder.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestSTATICFS(t *testing.T) {
+	fileSystem := fstest.MapFS{
+		"index.html":       {Data: []byte("<html>index</html>")},
+		"docs/guide.txt":   {Data: []byte("guide")},
+		"docs/.secret":     {Data: []byte("secret")},
+		".git/config":      {Data: []byte("config")},
+		"files/a.txt":      {Data: []byte("a")},
+		"files/.hidden":    {Data: []byte("hidden")},
+		"files/sub/b.txt":  {Data: []byte("b")},
+		"public/.well/key": {Data: []byte("key")},
+	}
+	m := NewMagic("0")
+	m.STATICFS("/fs", fileSystem, StaticConfig{})
+	m.STATICFS("/browse", fileSystem, StaticConfig{Browse: true})
+	m.STATICFS("/hidden", fileSystem, StaticConfig{AllowHidden: true, Browse: true})
+
+	cases := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/fs/", http.StatusOK, "<html>index</html>"},
+		{"/fs/docs/guide.txt", http.StatusOK, "guide"},
+		{"/fs/missing.txt", http.StatusNotFound, ""},
+		{"/fs/docs/.secret", http.StatusNotFound, ""},
+		{"/fs/.git/config", http.StatusNotFound, ""},
+		{"/fs/public/.well/key", http.StatusNotFound, ""},
+		{"/fs/files/", http.StatusNotFound, ""},
+		{"/fs/../static_test.go", http.StatusBadRequest, ""},
+		{"/fs/docs/../../static_test.go", http.StatusBadRequest, ""},
+		{"/fs/docs/..%5c..%5cstatic_test.go", http.StatusBadRequest, ""},
+		{"/fs/docs/%2e%2e/guide.txt", http.StatusBadRequest, ""},
+		{"/fs/docs%00/guide.txt", http.StatusBadRequest, ""},
+		{"/hidden/docs/.secret", http.StatusOK, "secret"},
+		{"/hidden/.git/config", http.StatusOK, "config"},
+	}
+	for _, test := range cases {
+		recorder := serveStatic(m, test.path, "")
+		if recorder.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.code, recorder.Code)
+		}
+		if test.body != "" && recorder.Body.String() != test.body {
+			t.Fatalf("%s: expected %q, got %q", test.path, test.body, recorder.Body.String())
+		}
+	}
+
+	listing := serveStatic(m, "/browse/files/", "").Body.String()
+	if !strings.Contains(listing, `<a href="a.txt">a.txt</a>`) || !strings.Contains(listing, `<a href="sub/">sub/</a>`) {
+		t.Fatalf("directory is not listed: %q", listing)
+	}
+	if strings.Contains(listing, ".hidden") {
+		t.Fatalf("hidden file is listed: %q", listing)
+	}
+	if listing := serveStatic(m, "/hidden/files/", "").Body.String(); !strings.Contains(listing, ".hidden") {
+		t.Fatalf("hidden file is not listed with AllowHidden: %q", listing)
+	}
+	if recorder := serveStatic(m, "/browse/files", ""); recorder.Code != http.StatusMovedPermanently || recorder.Header().Get("Location") != "/browse/files/" {
+		t.Fatalf("directory without slash is not redirected: %d %q", recorder.Code, recorder.Header().Get("Location"))
+	}
+}
+
+func TestStaticFileName(t *testing.T) {
+	server := &staticServer{prefix: "/static"}
+	cases := []struct {
+		path string
+		name string
+		ok   bool
+	}{
+		{"/static/a/b.txt", "/a/b.txt", true},
+		{"/static", "/", true},
+		{"/static/a//b/./c.txt", "/a/b/c.txt", true},
+		{"/static/a..b.txt", "/a..b.txt", true},
+		{"/static/../secret", "", false},
+		{"/static/a/../../secret", "", false},
+		{"/static/a/..", "", false},
+		{"/static/a\\..\\secret", "", false},
+		{"/static/a\x00.txt", "", false},
+	}
+	for _, test := range cases {
+		name, ok := server.fileName(test.path)
+		if name != test.name || ok != test.ok {
+			t.Fatalf("%q: expected %q %v, got %q %v", test.path, test.name, test.ok, name, ok)
+		}
+	}
+}
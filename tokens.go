@@ -0,0 +1,328 @@
+package magic
+
+import (
+	"crypto"
+	"errors"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	errJWTRevoked      = errors.New("JWT is revoked")
+	errJWTType         = errors.New("JWT has invalid type")
+	errRefreshReused   = errors.New("refresh token is reused, all tokens of session are revoked")
+	errTokenSigningKey = errors.New("token service needs signing key")
+)
+
+// Token types in "typ" claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+var reservedTokenClaims = []string{"jti", "fam", "typ", "iat", "exp", "nbf", "iss", "aud"}
+
+// RevocationStore interface
+// Store of revoked token ids, implement it to use Redis or other storage
+// Revoke returns true if id was already revoked, it must be atomic
+type RevocationStore interface {
+	Revoke(id string, expiresAt time.Time) (bool, error)
+	IsRevoked(id string) (bool, error)
+}
+
+// MemoryRevocationStore structure
+// RevocationStore which keeps ids in memory of process
+type MemoryRevocationStore struct {
+	mutex       sync.Mutex
+	ids         map[string]time.Time
+	lastCleanup time.Time
+}
+
+// NewMemoryRevocationStore function
+// Create new MemoryRevocationStore
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		ids:         make(map[string]time.Time),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Revoke function
+// Revoke id until expiresAt, return true if it was already revoked
+func (store *MemoryRevocationStore) Revoke(id string, expiresAt time.Time) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(store.lastCleanup) > time.Minute {
+		store.lastCleanup = now
+		for key, expires := range store.ids {
+			if now.After(expires) {
+				delete(store.ids, key)
+			}
+		}
+	}
+	expires, ok := store.ids[id]
+	if ok && now.Before(expires) {
+		if expiresAt.After(expires) {
+			store.ids[id] = expiresAt
+		}
+		return true, nil
+	}
+	store.ids[id] = expiresAt
+	return false, nil
+}
+
+// IsRevoked function
+// Return true if id is revoked
+func (store *MemoryRevocationStore) IsRevoked(id string) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	expires, ok := store.ids[id]
+	return ok && time.Now().Before(expires), nil
+}
+
+// TokenServiceConfig structure
+// Method - signing method (default jwt.SigningMethodHS256)
+// SigningKey - []byte for HMAC or private key (*rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey)
+// KeyID - kid of tokens if not empty
+// KeyProvider - keys for verification (default SigningKey or its public key)
+// AccessTTL - lifetime of access token (default 15 minutes)
+// RefreshTTL - lifetime of refresh token (default 30 days)
+// Issuer - iss of tokens if not empty
+// Audience - aud of tokens if not empty
+// Revocation - store of revoked tokens (default NewMemoryRevocationStore())
+type TokenServiceConfig struct {
+	Method      jwt.SigningMethod
+	SigningKey  interface{}
+	KeyID       string
+	KeyProvider JWTKeyProvider
+	AccessTTL   time.Duration
+	RefreshTTL  time.Duration
+	Issuer      string
+	Audience    string
+	Revocation  RevocationStore
+}
+
+// TokenPair structure
+// Access and refresh tokens with time of expiration
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenService structure
+// Issue access and refresh tokens, rotate refresh tokens and detect reuse
+// All tokens of one login have same "fam" claim
+// If used refresh token is presented again all tokens of its family are revoked
+type TokenService struct {
+	config    TokenServiceConfig
+	jwtConfig JWTConfig
+}
+
+// NewTokenService function
+// Create new TokenService
+func NewTokenService(config TokenServiceConfig) *TokenService {
+	if config.SigningKey == nil {
+		panic(errTokenSigningKey)
+	}
+	if config.Method == nil {
+		config.Method = jwt.SigningMethodHS256
+	}
+	if config.AccessTTL <= 0 {
+		config.AccessTTL = 15 * time.Minute
+	}
+	if config.RefreshTTL <= 0 {
+		config.RefreshTTL = 30 * 24 * time.Hour
+	}
+	if config.Revocation == nil {
+		config.Revocation = NewMemoryRevocationStore()
+	}
+	if config.KeyProvider == nil {
+		config.KeyProvider = staticKeyProvider{key: verificationKey(config.SigningKey)}
+	}
+	return &TokenService{
+		config: config,
+		jwtConfig: JWTConfig{
+			KeyProvider: config.KeyProvider,
+			Algorithms:  []string{config.Method.Alg()},
+			Issuer:      config.Issuer,
+			Audience:    config.Audience,
+			Revocation:  config.Revocation,
+		},
+	}
+}
+
+// Middleware function
+// Return JWT middleware which accepts access tokens of service
+// Claims will contains in context.Storage[ClaimsKey]
+func (service *TokenService) Middleware() Middleware {
+	return NewJWTMiddlewareWithConfig(service.jwtConfig)
+}
+
+// Issue function
+// Issue new pair of tokens for new login
+func (service *TokenService) Issue(claims map[string]interface{}) (TokenPair, error) {
+	return service.issue(claims, randomID())
+}
+
+// Refresh function
+// Check refresh token, revoke it and issue new pair
+// If refresh token was already used all tokens of its family are revoked
+func (service *TokenService) Refresh(refreshToken string) (TokenPair, error) {
+	claims, err := parseJWT(refreshToken, service.jwtConfig)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if claims["typ"] != TokenTypeRefresh {
+		return TokenPair{}, errJWTType
+	}
+	jti, _ := claims["jti"].(string)
+	family, _ := claims["fam"].(string)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" || family == "" {
+		return TokenPair{}, errJWTInvalid
+	}
+	familyRevoked, err := service.config.Revocation.IsRevoked(familyRevocationID(family))
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if familyRevoked {
+		return TokenPair{}, errJWTRevoked
+	}
+
+	alreadyUsed, err := service.config.Revocation.Revoke(jti, time.Unix(int64(exp)+1, 0))
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if alreadyUsed {
+		if err := service.RevokeFamily(family); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, errRefreshReused
+	}
+
+	for _, name := range reservedTokenClaims {
+		delete(claims, name)
+	}
+	return service.issue(claims, family)
+}
+
+// Revoke function
+// Revoke one access or refresh token
+func (service *TokenService) Revoke(tokenStr string) error {
+	claims, err := parseJWT(tokenStr, service.jwtConfig)
+	if err != nil {
+		return err
+	}
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" {
+		return errJWTInvalid
+	}
+	_, err = service.config.Revocation.Revoke(jti, time.Unix(int64(exp)+1, 0))
+	return err
+}
+
+// RevokeFamily function
+// Revoke all tokens of one login (logout from all devices of this session)
+func (service *TokenService) RevokeFamily(family string) error {
+	ttl := service.config.RefreshTTL
+	if service.config.AccessTTL > ttl {
+		ttl = service.config.AccessTTL
+	}
+	_, err := service.config.Revocation.Revoke(familyRevocationID(family), time.Now().Add(ttl))
+	return err
+}
+
+func (service *TokenService) issue(claims map[string]interface{}, family string) (TokenPair, error) {
+	now := time.Now()
+	pair := TokenPair{
+		AccessExpiresAt:  now.Add(service.config.AccessTTL),
+		RefreshExpiresAt: now.Add(service.config.RefreshTTL),
+	}
+	var err error
+	pair.AccessToken, err = service.sign(claims, TokenTypeAccess, family, now, pair.AccessExpiresAt)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	pair.RefreshToken, err = service.sign(claims, TokenTypeRefresh, family, now, pair.RefreshExpiresAt)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return pair, nil
+}
+
+func (service *TokenService) sign(claims map[string]interface{}, tokenType, family string, now, expiresAt time.Time) (string, error) {
+	tokenClaims := jwt.MapClaims{}
+	for key, value := range claims {
+		tokenClaims[key] = value
+	}
+	tokenClaims["jti"] = randomID()
+	tokenClaims["fam"] = family
+	tokenClaims["typ"] = tokenType
+	tokenClaims["iat"] = now.Unix()
+	tokenClaims["exp"] = expiresAt.Unix()
+	if service.config.Issuer != "" {
+		tokenClaims["iss"] = service.config.Issuer
+	}
+	if service.config.Audience != "" {
+		tokenClaims["aud"] = service.config.Audience
+	}
+	token := jwt.NewWithClaims(service.config.Method, tokenClaims)
+	if service.config.KeyID != "" {
+		token.Header["kid"] = service.config.KeyID
+	}
+	return token.SignedString(service.config.SigningKey)
+}
+
+// checkRevocation function
+// Return error if jti or family of token is revoked
+func checkRevocation(claims jwt.MapClaims, store RevocationStore) error {
+	if store == nil {
+		return nil
+	}
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		revoked, err := store.IsRevoked(jti)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return errJWTRevoked
+		}
+	}
+	if family, ok := claims["fam"].(string); ok && family != "" {
+		revoked, err := store.IsRevoked(familyRevocationID(family))
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return errJWTRevoked
+		}
+	}
+	return nil
+}
+
+func familyRevocationID(family string) string {
+	return "family:" + family
+}
+
+type staticKeyProvider struct {
+	key interface{}
+}
+
+func (provider staticKeyProvider) Key(token *jwt.Token) (interface{}, error) {
+	return provider.key, nil
+}
+
+// verificationKey function
+// Return public key of private key, []byte is returned as is
+func verificationKey(key interface{}) interface{} {
+	if signer, ok := key.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return key
+}
@@ -0,0 +1,117 @@
+package magic
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// expectTokenAccepted function
+// Check that middleware of service accepts or rejects token with err
+func expectTokenAccepted(t *testing.T, service *TokenService, token string, err error) {
+	t.Helper()
+	recorder := serveJWT(service.Middleware(), token)
+	if err == nil {
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected token to be accepted, got %d %s", recorder.Code, recorder.Body.String())
+		}
+		return
+	}
+	if recorder.Code != http.StatusUnauthorized || !strings.Contains(recorder.Body.String(), err.Error()) {
+		t.Fatalf("expected %q, got %d %s", err, recorder.Code, recorder.Body.String())
+	}
+}
+
+func newTestTokenServices(t *testing.T) map[string]*TokenService {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*TokenService{
+		"HS256": NewTokenService(TokenServiceConfig{SigningKey: []byte("token key"), Issuer: "magic"}),
+		"ES256": NewTokenService(TokenServiceConfig{Method: jwt.SigningMethodES256, SigningKey: ecKey, KeyID: "ec", Audience: "api"}),
+	}
+}
+
+func TestTokenServiceRotation(t *testing.T) {
+	for name, service := range newTestTokenServices(t) {
+		t.Run(name, func(t *testing.T) {
+			pair, err := service.Issue(map[string]interface{}{"sub": "bob", "exp": 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pair.AccessExpiresAt.Before(pair.RefreshExpiresAt) || pair.AccessExpiresAt.Before(time.Now()) {
+				t.Fatalf("wrong expiration %v %v", pair.AccessExpiresAt, pair.RefreshExpiresAt)
+			}
+			expectTokenAccepted(t, service, pair.AccessToken, nil)
+			expectTokenAccepted(t, service, pair.RefreshToken, errJWTType)
+			if _, err := service.Refresh(pair.AccessToken); err != errJWTType {
+				t.Fatalf("access token is accepted as refresh token: %v", err)
+			}
+
+			rotated, err := service.Refresh(pair.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := parseJWT(rotated.AccessToken, service.jwtConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old, _ := parseJWT(pair.AccessToken, service.jwtConfig)
+			if claims["sub"] != "bob" || claims["fam"] != old["fam"] || claims["jti"] == old["jti"] {
+				t.Fatalf("rotated token has wrong claims %v", claims)
+			}
+			expectTokenAccepted(t, service, rotated.AccessToken, nil)
+
+			if _, err := service.Refresh(pair.RefreshToken); err != errRefreshReused {
+				t.Fatalf("expected %q, got %v", errRefreshReused, err)
+			}
+			if _, err := service.Refresh(rotated.RefreshToken); err != errJWTRevoked {
+				t.Fatalf("token of reused family is not revoked: %v", err)
+			}
+			expectTokenAccepted(t, service, rotated.AccessToken, errJWTRevoked)
+		})
+	}
+}
+
+func TestTokenServiceRevoke(t *testing.T) {
+	service := NewTokenService(TokenServiceConfig{SigningKey: []byte("token key")})
+	first, _ := service.Issue(map[string]interface{}{"sub": "bob"})
+	second, _ := service.Issue(map[string]interface{}{"sub": "bob"})
+
+	if err := service.Revoke(first.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	expectTokenAccepted(t, service, first.AccessToken, errJWTRevoked)
+	expectTokenAccepted(t, service, second.AccessToken, nil)
+	if _, err := service.Refresh(first.RefreshToken); err != nil {
+		t.Fatalf("refresh token is revoked with access token: %v", err)
+	}
+
+	claims, _ := parseJWT(second.AccessToken, service.jwtConfig)
+	if err := service.RevokeFamily(claims["fam"].(string)); err != nil {
+		t.Fatal(err)
+	}
+	expectTokenAccepted(t, service, second.AccessToken, errJWTRevoked)
+	if _, err := service.Refresh(second.RefreshToken); err != errJWTRevoked {
+		t.Fatalf("expected %q, got %v", errJWTRevoked, err)
+	}
+	if err := service.Revoke("invalid"); err != errJWTInvalid {
+		t.Fatalf("expected %q, got %v", errJWTInvalid, err)
+	}
+}
+
+func TestTokenServiceWithoutKeyPanics(t *testing.T) {
+	defer func() {
+		if recover() != errTokenSigningKey {
+			t.Fatal("expected panic without signing key")
+		}
+	}()
+	NewTokenService(TokenServiceConfig{})
+}
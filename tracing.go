@@ -0,0 +1,352 @@
+package magic
+
+import (
+	stdcontext "context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errTraceParent = errors.New("invalid traceparent")
+)
+
+// SpanContext structure
+// Identifies span like in W3C traceparent header
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+// IsValid function
+// Return true if trace id and span id are not zero
+func (spanContext SpanContext) IsValid() bool {
+	return spanContext.TraceID != [16]byte{} && spanContext.SpanID != [8]byte{}
+}
+
+// IsSampled function
+// Return true if sampled flag is set
+func (spanContext SpanContext) IsSampled() bool {
+	return spanContext.Flags&0x01 == 0x01
+}
+
+// TraceParent function
+// Return value of traceparent header like "00-<trace id>-<span id>-<flags>"
+func (spanContext SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(spanContext.TraceID[:]) + "-" +
+		hex.EncodeToString(spanContext.SpanID[:]) + "-" + hex.EncodeToString([]byte{spanContext.Flags})
+}
+
+// ParseTraceParent function
+// Parse traceparent and tracestate headers
+func ParseTraceParent(traceParent, traceState string) (SpanContext, error) {
+	spanContext := SpanContext{}
+	traceParent = strings.TrimSpace(traceParent)
+	if len(traceParent) < 55 || (len(traceParent) > 55 && traceParent[55] != '-') {
+		return spanContext, errTraceParent
+	}
+	parts := strings.Split(traceParent[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 {
+		return spanContext, errTraceParent
+	}
+	for _, part := range parts {
+		if strings.ToLower(part) != part {
+			return spanContext, errTraceParent
+		}
+	}
+	version := []byte{0}
+	if _, err := hex.Decode(version, []byte(parts[0])); err != nil || version[0] == 0xff {
+		return spanContext, errTraceParent
+	}
+	if version[0] == 0 && len(traceParent) != 55 {
+		return spanContext, errTraceParent
+	}
+	if _, err := hex.Decode(spanContext.TraceID[:], []byte(parts[1])); err != nil {
+		return spanContext, errTraceParent
+	}
+	if _, err := hex.Decode(spanContext.SpanID[:], []byte(parts[2])); err != nil {
+		return spanContext, errTraceParent
+	}
+	flags := []byte{0}
+	if _, err := hex.Decode(flags, []byte(parts[3])); err != nil {
+		return spanContext, errTraceParent
+	}
+	spanContext.Flags = flags[0]
+	if !spanContext.IsValid() {
+		return SpanContext{}, errTraceParent
+	}
+	spanContext.TraceState = strings.TrimSpace(traceState)
+	spanContext.Remote = true
+	return spanContext, nil
+}
+
+// Span interface
+// Span of trace, implement it to use OpenTelemetry or other tracing
+type Span interface {
+	SpanContext() SpanContext
+	SetName(name string)
+	SetAttribute(key string, value interface{})
+	SetStatus(code int)
+	RecordError(err error)
+	End()
+}
+
+// Tracer interface
+// Start new span, parent is remote span from headers or invalid SpanContext
+// If parent is invalid use span from ctx as parent
+type Tracer interface {
+	Start(ctx stdcontext.Context, name string, parent SpanContext) (stdcontext.Context, Span)
+}
+
+type spanKey struct{}
+
+// ContextWithSpan function
+// Return ctx which contains span
+func ContextWithSpan(ctx stdcontext.Context, span Span) stdcontext.Context {
+	return stdcontext.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext function
+// Return span from ctx or nil
+func SpanFromContext(ctx stdcontext.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// TracingConfig structure
+// Tracer - tracer which starts spans (default NewTracer(nil))
+type TracingConfig struct {
+	Tracer Tracer
+}
+
+// NewTracingMiddleware function
+// Create new tracing middleware, use it in magic.Use
+// Span is named by method and route pattern like "GET /users/:id"
+// Span is available in context.Span() and context.Request.Context()
+func NewTracingMiddleware(config TracingConfig) Middleware {
+	if config.Tracer == nil {
+		config.Tracer = NewTracer(nil)
+	}
+	return NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) error {
+			parent, _ := ParseTraceParent(context.Request.Header.Get("traceparent"), context.Request.Header.Get("tracestate"))
+			route := context.Route.FullPath()
+			name := context.Request.Method
+			if route != "" {
+				name += " " + route
+			}
+
+			ctx, span := config.Tracer.Start(context.Request.Context(), name, parent)
+			defer span.End()
+			span.SetAttribute("http.method", context.Request.Method)
+			span.SetAttribute("http.target", context.Request.URL.RequestURI())
+			if route != "" {
+				span.SetAttribute("http.route", route)
+			}
+			if context.RequestID != "" {
+				span.SetAttribute("request_id", context.RequestID)
+			}
+
+			request := context.Request
+			context.Request = request.WithContext(ctx)
+			context.span = span
+			defer func() {
+				context.Request = request
+			}()
+			err := next(context)
+
+			span.SetAttribute("http.status_code", context.Response.Status())
+			span.SetStatus(context.Response.Status())
+			if err != nil {
+				span.RecordError(err)
+			}
+			return err
+		}
+	})
+}
+
+// Span function
+// Return span of request, it is never nil
+func (context *Context) Span() Span {
+	if context.span == nil {
+		return noopSpan{}
+	}
+	return context.span
+}
+
+// InjectTrace function
+// Set traceparent and tracestate of request span to headers of outgoing request
+func (context *Context) InjectTrace(header http.Header) {
+	spanContext := context.Span().SpanContext()
+	if !spanContext.IsValid() {
+		return
+	}
+	header.Set("traceparent", spanContext.TraceParent())
+	if spanContext.TraceState != "" {
+		header.Set("tracestate", spanContext.TraceState)
+	}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext         { return SpanContext{} }
+func (noopSpan) SetName(string)                   {}
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) SetStatus(int)                    {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
+
+// SpanData structure
+// Finished span, it is sent to SpanExporter
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]interface{}
+	Status      int
+	Errors      []error
+}
+
+// SpanExporter interface
+// Get finished spans from tracer of NewTracer
+type SpanExporter interface {
+	ExportSpan(span SpanData)
+}
+
+// NewTracer function
+// Create simple tracer which sends finished spans to exporter
+// Exporter can be nil
+func NewTracer(exporter SpanExporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter SpanExporter
+}
+
+func (tracer *tracer) Start(ctx stdcontext.Context, name string, parent SpanContext) (stdcontext.Context, Span) {
+	if !parent.IsValid() {
+		if parentSpan := SpanFromContext(ctx); parentSpan != nil {
+			parent = parentSpan.SpanContext()
+		}
+	}
+	spanContext := SpanContext{
+		Flags: 0x01,
+	}
+	if parent.IsValid() {
+		spanContext.TraceID = parent.TraceID
+		spanContext.Flags = parent.Flags
+		spanContext.TraceState = parent.TraceState
+	} else {
+		rand.Read(spanContext.TraceID[:])
+	}
+	rand.Read(spanContext.SpanID[:])
+
+	span := &span{
+		tracer: tracer,
+		data: SpanData{
+			Name:        name,
+			SpanContext: spanContext,
+			Parent:      parent,
+			Start:       time.Now(),
+			Attributes:  make(map[string]interface{}),
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+type span struct {
+	mutex  sync.Mutex
+	tracer *tracer
+	data   SpanData
+	ended  bool
+}
+
+func (span *span) SpanContext() SpanContext {
+	return span.data.SpanContext
+}
+
+func (span *span) SetName(name string) {
+	span.mutex.Lock()
+	span.data.Name = name
+	span.mutex.Unlock()
+}
+
+func (span *span) SetAttribute(key string, value interface{}) {
+	span.mutex.Lock()
+	span.data.Attributes[key] = value
+	span.mutex.Unlock()
+}
+
+func (span *span) SetStatus(code int) {
+	span.mutex.Lock()
+	span.data.Status = code
+	span.mutex.Unlock()
+}
+
+func (span *span) RecordError(err error) {
+	span.mutex.Lock()
+	span.data.Errors = append(span.data.Errors, err)
+	span.mutex.Unlock()
+}
+
+func (span *span) End() {
+	span.mutex.Lock()
+	if span.ended {
+		span.mutex.Unlock()
+		return
+	}
+	span.ended = true
+	span.data.End = time.Now()
+	data := span.data
+	span.mutex.Unlock()
+	if span.tracer.exporter != nil {
+		span.tracer.exporter.ExportSpan(data)
+	}
+}
+
+// InMemoryExporter structure
+// SpanExporter which keeps spans in memory, use it in tests
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter function
+// Create new InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpan function
+// Save finished span
+func (exporter *InMemoryExporter) ExportSpan(span SpanData) {
+	exporter.mutex.Lock()
+	exporter.spans = append(exporter.spans, span)
+	exporter.mutex.Unlock()
+}
+
+// Spans function
+// Return all saved spans
+func (exporter *InMemoryExporter) Spans() []SpanData {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	return append([]SpanData{}, exporter.spans...)
+}
+
+// Reset function
+// Remove all saved spans
+func (exporter *InMemoryExporter) Reset() {
+	exporter.mutex.Lock()
+	exporter.spans = nil
+	exporter.mutex.Unlock()
+}
@@ -0,0 +1,133 @@
+package magic
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID      = "00f067aa0ba902b7"
+	testTraceParent = "00-" + testTraceID + "-" + testSpanID + "-01"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	cases := []struct {
+		name        string
+		traceParent string
+		valid       bool
+	}{
+		{"valid", testTraceParent, true},
+		{"not sampled", "00-" + testTraceID + "-" + testSpanID + "-00", true},
+		{"future version with suffix", "cc-" + testTraceID + "-" + testSpanID + "-01-what-the-future-holds", true},
+		{"version 00 with suffix", testTraceParent + "-extra", false},
+		{"version ff", "ff-" + testTraceID + "-" + testSpanID + "-01", false},
+		{"version not hex", "zz-" + testTraceID + "-" + testSpanID + "-01", false},
+		{"uppercase hex", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanID + "-01", false},
+		{"zero trace id", "00-00000000000000000000000000000000-" + testSpanID + "-01", false},
+		{"zero span id", "00-" + testTraceID + "-0000000000000000-01", false},
+		{"short", "00-" + testTraceID + "-" + testSpanID, false},
+		{"empty", "", false},
+	}
+	for _, test := range cases {
+		spanContext, err := ParseTraceParent(test.traceParent, " vendor=value ")
+		if !test.valid {
+			if err != errTraceParent {
+				t.Fatalf("%s: expected %q, got %v", test.name, errTraceParent, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !spanContext.Remote || spanContext.TraceState != "vendor=value" {
+			t.Fatalf("%s: wrong span context %+v", test.name, spanContext)
+		}
+		if test.traceParent[:2] == "00" && spanContext.TraceParent() != test.traceParent {
+			t.Fatalf("%s: expected %s, got %s", test.name, test.traceParent, spanContext.TraceParent())
+		}
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	errHandler := errors.New("user not found")
+	var injected http.Header
+	router := NewRouter()
+	router.Use(NewTracingMiddleware(TracingConfig{Tracer: NewTracer(exporter)}))
+	router.mainRoute.GET("/users/:id", func(context *Context) error {
+		if SpanFromContext(context.Request.Context()) != context.Span() {
+			t.Error("span is not in request context")
+		}
+		injected = http.Header{}
+		context.InjectTrace(injected)
+		context.Writer.WriteHeader(http.StatusNotFound)
+		context.SendError(errHandler)
+		return errHandler
+	})
+
+	request := httptest.NewRequest("GET", "/users/42", nil)
+	request.Header.Set("traceparent", testTraceParent)
+	request.Header.Set("tracestate", "vendor=value")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /users/:id" || span.Attributes["http.route"] != "/users/:id" {
+		t.Fatalf("wrong span name %q or route %v", span.Name, span.Attributes["http.route"])
+	}
+	if span.Parent.TraceParent() != testTraceParent || span.SpanContext.TraceID != span.Parent.TraceID {
+		t.Fatalf("parent is not taken from traceparent: %+v", span.Parent)
+	}
+	if span.SpanContext.SpanID == span.Parent.SpanID {
+		t.Fatal("span has id of parent")
+	}
+	if span.Status != http.StatusNotFound || len(span.Errors) != 1 || span.Errors[0] != errHandler {
+		t.Fatalf("wrong status %d or errors %v", span.Status, span.Errors)
+	}
+	if span.End.Before(span.Start) {
+		t.Fatal("span is not ended")
+	}
+	if injected.Get("traceparent") != span.SpanContext.TraceParent() || injected.Get("tracestate") != "vendor=value" {
+		t.Fatalf("wrong injected headers %v", injected)
+	}
+
+	exporter.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil))
+	spans = exporter.Spans()
+	if len(spans) != 1 || spans[0].Parent.IsValid() || !spans[0].SpanContext.IsValid() {
+		t.Fatalf("expected new root span, got %+v", spans)
+	}
+}
+
+func TestTracingMiddlewarePanic(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	var original, recovered *http.Request
+	router := NewRouter()
+	router.Use(NewWrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(context *Context) error {
+			original = context.Request
+			defer func() {
+				recover()
+				recovered = context.Request
+			}()
+			return next(context)
+		}
+	}))
+	router.Use(NewTracingMiddleware(TracingConfig{Tracer: NewTracer(exporter)}))
+	router.mainRoute.GET("/panic", func(context *Context) error {
+		panic("handler failed")
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	if recovered != original {
+		t.Fatal("request of span is left in context after panic")
+	}
+	if len(exporter.Spans()) != 1 {
+		t.Fatal("span is not ended after panic")
+	}
+}